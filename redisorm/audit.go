@@ -0,0 +1,181 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// AuditTrail تنظیمات ثبت سابقه تغییرات (audit) یک مدل است.
+type AuditTrail struct {
+	// MaxLen طول هر stream سابقه را به‌صورت تقریبی محدود می‌کند؛ صفر یعنی بدون محدودیت.
+	MaxLen int64
+}
+
+// Auditor یک اینترفیس برای مدل‌هایی است که می‌خواهند انجام‌دهنده، زمان، نوع عملیات و تغییرات
+// فیلدهای هر Save، UpdateFields، UpdateFieldsFast و Delete در همان اسکریپت Lua نوشتن، در stream
+// سابقه رکورد ({namespace}:audit:{ModelName}:{id}) و stream انجام‌دهنده
+// ({namespace}:auditby:{ModelName}:{actor}) ثبت شود. سابقه با حذف رکورد پاک نمی‌شود.
+type Auditor interface {
+	AuditTrail() AuditTrail
+}
+
+// Actor انجام‌دهنده یک تغییر است.
+type Actor struct {
+	ID        string // شناسه کاربر یا سرویس؛ سابقه هر ID با AuditByActor خوانده می‌شود
+	Service   string // نام سرویس
+	RequestID string // شناسه درخواست
+}
+
+type actorCtxKey struct{}
+
+// WithActor انجام‌دهنده تغییرات را به context اضافه می‌کند تا در سابقه مدل‌های Auditor ثبت شود.
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorCtxKey{}, actor)
+}
+
+// ActorFrom انجام‌دهنده موجود در context را برمی‌گرداند.
+func ActorFrom(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorCtxKey{}).(Actor)
+	return a
+}
+
+// FieldChange تغییر یک فیلد در AuditEntry است. مقدار فیلدهای secret ثبت نمی‌شود و فقط Masked
+// تنظیم می‌شود؛ این فیلدها با هر Save دوباره رمز می‌شوند و بنابراین همیشه تغییرکرده محسوب می‌شوند.
+type FieldChange struct {
+	Old    json.RawMessage `json:"old,omitempty"` // خالی برای فیلدی که پیش‌تر وجود نداشت
+	New    json.RawMessage `json:"new,omitempty"` // خالی برای فیلد حذف‌شده
+	Masked bool            `json:"masked,omitempty"`
+}
+
+// AuditEntry یک ورودی سابقه تغییرات است.
+type AuditEntry struct {
+	StreamID string
+	At       time.Time // زمان تغییر (از شناسه ورودی stream)
+	Actor    Actor
+	Op       string // OpCreate، OpUpdate یا OpDelete
+	Model    string
+	ID       string
+	Version  int64                  // مقدار کلید نسخه پس از نوشتن (برای حذف، پیش از آن)
+	Changes  map[string]FieldChange // بر اساس نام JSON فیلد
+}
+
+func (c *Client) keyAudit(modelPrefix, id string) string {
+	return fmt.Sprintf("%s:audit:%s:%s", c.ns, modelPrefix, id)
+}
+
+func (c *Client) keyAuditActor(modelPrefix, actor string) string {
+	return fmt.Sprintf("%s:auditby:%s:%s", c.ns, modelPrefix, actor)
+}
+
+// auditKeys کلیدهای سابقه رکورد و انجام‌دهنده را برای اسکریپت‌های نوشتن آماده می‌کند.
+func (c *Client) auditKeys(ctx context.Context, modelPrefix, id string) []string {
+	return []string{c.keyAudit(modelPrefix, id), c.keyAuditActor(modelPrefix, ActorFrom(ctx).ID)}
+}
+
+// auditArgs تنظیمات audit را برای اسکریپت‌های نوشتن آماده می‌کند:
+// {mode, maxLen, actor, service, request, secrets}.
+func (c *Client) auditArgs(ctx context.Context, meta *ModelMetadata) []interface{} {
+	if meta.Audit == nil {
+		return []interface{}{"", 0, "", "", "", "[]"}
+	}
+	secrets := make([]string, 0, len(meta.SecretFields))
+	for _, fieldName := range meta.SecretFields {
+		secrets = append(secrets, meta.JsonNames[fieldName])
+	}
+	list, _ := json.Marshal(secrets)
+	a := ActorFrom(ctx)
+	return []interface{}{"1", meta.Audit.MaxLen, a.ID, a.Service, a.RequestID, string(list)}
+}
+
+func parseAuditEntry(model string, msg redis.XMessage) (AuditEntry, error) {
+	str := func(k string) string { s, _ := msg.Values[k].(string); return s }
+	e := AuditEntry{
+		StreamID: msg.ID,
+		Actor:    Actor{ID: str("actor"), Service: str("service"), RequestID: str("request")},
+		Op:       str("op"),
+		Model:    model,
+		ID:       str("id"),
+	}
+	ms, _ := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64)
+	e.At = time.UnixMilli(ms)
+	version, err := strconv.ParseInt(str("version"), 10, 64)
+	if err != nil {
+		return e, fmt.Errorf("audit entry %s: bad version: %w", msg.ID, err)
+	}
+	e.Version = version
+	if err := json.Unmarshal([]byte(str("diff")), &e.Changes); err != nil {
+		return e, fmt.Errorf("audit entry %s: bad diff: %w", msg.ID, err)
+	}
+	return e, nil
+}
+
+// readAudit ورودی‌های یک stream سابقه را از جدیدترین به قدیمی‌ترین می‌خواند؛ limit صفر یعنی همه.
+func (c *Client) readAudit(ctx context.Context, meta *ModelMetadata, key string, limit int64) ([]AuditEntry, error) {
+	var msgs []redis.XMessage
+	var err error
+	if limit > 0 {
+		msgs, err = c.rdb.XRevRangeN(ctx, key, "+", "-", limit).Result()
+	} else {
+		msgs, err = c.rdb.XRevRange(ctx, key, "+", "-").Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]AuditEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		e, err := parseAuditEntry(c.modelName(meta), msg)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (c *Client) auditMeta(sample any) (*ModelMetadata, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Audit == nil {
+		return nil, fmt.Errorf("%s is not audited; implement Auditor", meta.StructName)
+	}
+	return meta, nil
+}
+
+// AuditLog سابقه تغییرات یک رکورد را از جدیدترین به قدیمی‌ترین برمی‌گرداند؛ id مانند Load تعیین
+// می‌شود و limit صفر یعنی همه ورودی‌ها.
+func (c *Client) AuditLog(ctx context.Context, sample any, id any, limit int64) ([]AuditEntry, error) {
+	meta, err := c.auditMeta(sample)
+	if err != nil {
+		return nil, err
+	}
+	key, err := recordID(meta, sample, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("empty pk for AuditLog")
+	}
+	return c.readAudit(ctx, meta, c.keyAudit(c.modelPrefix(meta), key), limit)
+}
+
+// AuditByActor تغییراتی را که انجام‌دهنده با شناسه actor روی رکوردهای مدل انجام داده است از
+// جدیدترین به قدیمی‌ترین برمی‌گرداند؛ limit صفر یعنی همه ورودی‌ها.
+func (c *Client) AuditByActor(ctx context.Context, sample any, actor string, limit int64) ([]AuditEntry, error) {
+	meta, err := c.auditMeta(sample)
+	if err != nil {
+		return nil, err
+	}
+	if actor == "" {
+		return nil, errors.New("empty actor for AuditByActor")
+	}
+	return c.readAudit(ctx, meta, c.keyAuditActor(c.modelPrefix(meta), actor), limit)
+}
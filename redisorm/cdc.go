@@ -0,0 +1,224 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ChangeCapture تنظیمات ثبت تغییرات (CDC) یک مدل است.
+type ChangeCapture struct {
+	// IncludeDocument سند ذخیره‌شده را (با فیلدهای secret به‌صورت رمز‌شده) در رویداد قرار می‌دهد.
+	IncludeDocument bool
+	// MaxLen طول stream را به‌صورت تقریبی محدود می‌کند؛ صفر یعنی بدون محدودیت.
+	MaxLen int64
+}
+
+// ChangeCapturer یک اینترفیس برای مدل‌هایی است که می‌خواهند هر Save، Delete و UpdateFieldsFast
+// در همان اسکریپت Lua نوشتن، به Redis Stream مدل ({namespace}:cdc:{ModelName}) اضافه شود.
+type ChangeCapturer interface {
+	ChangeCapture() ChangeCapture
+}
+
+// نوع عملیات در ChangeEvent.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// ChangeEvent یک رویداد ثبت‌شده در stream تغییرات است.
+type ChangeEvent struct {
+	StreamID string   // شناسه ورودی stream
+	Op       string   // OpCreate، OpUpdate یا OpDelete
+	Model    string   // نام مدل (همراه گروه)
+	ID       string   // شناسه رکورد
+	Version  int64    // مقدار کلید نسخه پس از نوشتن (برای حذف، پیش از آن)
+	Fields   []string // نام JSON فیلدهای تغییرکرده؛ فیلدهای secret در هر Save تغییرکرده محسوب می‌شوند
+	Document string   // سند ذخیره‌شده در صورت فعال بودن IncludeDocument؛ با DecodeChange خوانده شود
+}
+
+func (c *Client) keyCDC(modelPrefix string) string {
+	return fmt.Sprintf("%s:cdc:%s", c.ns, modelPrefix)
+}
+
+// changeArgs تنظیمات CDC و اعلان تغییرات رکورد را برای اسکریپت‌های نوشتن آماده می‌کند:
+// {mode, model, maxLen, channel}.
+func (c *Client) changeArgs(meta *ModelMetadata, modelPrefix, id string) []interface{} {
+	mode, maxLen := "", int64(0)
+	if meta.Capture != nil {
+		mode, maxLen = "meta", meta.Capture.MaxLen
+		if meta.Capture.IncludeDocument {
+			mode = "doc"
+		}
+	}
+	channel := ""
+	if c.notify {
+		channel = c.keyWatch(modelPrefix, id)
+	}
+	return []interface{}{mode, c.modelName(meta), maxLen, channel}
+}
+
+func parseChangeEvent(msg redis.XMessage) (ChangeEvent, error) {
+	str := func(k string) string { s, _ := msg.Values[k].(string); return s }
+	ev := ChangeEvent{
+		StreamID: msg.ID,
+		Op:       str("op"),
+		Model:    str("model"),
+		ID:       str("id"),
+		Document: str("doc"),
+	}
+	version, err := strconv.ParseInt(str("version"), 10, 64)
+	if err != nil {
+		return ev, fmt.Errorf("change event %s: bad version: %w", msg.ID, err)
+	}
+	ev.Version = version
+	if err := json.Unmarshal([]byte(str("fields")), &ev.Fields); err != nil {
+		return ev, fmt.Errorf("change event %s: bad fields: %w", msg.ID, err)
+	}
+	return ev, nil
+}
+
+// DecodeChange سند رویداد را رمزگشایی کرده و در dst (از نوع مدل) قرار می‌دهد.
+func (c *Client) DecodeChange(ctx context.Context, ev ChangeEvent, dst any) error {
+	if ev.Document == "" {
+		return errors.New("change event has no document")
+	}
+	meta, err := c.getModelMetadata(dst)
+	if err != nil {
+		return err
+	}
+	plain, err := c.decryptForType(ctx, meta, ev.ID, ev.Document)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, dst)
+}
+
+// SubscribeOption گزینه‌های Subscribe است.
+type SubscribeOption func(*subscribeOptions)
+
+type subscribeOptions struct {
+	consumer string
+	start    string
+	batch    int64
+}
+
+// WithConsumer نام consumer در گروه را تعیین می‌کند (پیش‌فرض: نام میزبان و شناسه پردازه). رویدادهای
+// تأییدنشده هر consumer پس از راه‌اندازی دوباره با همان نام دوباره تحویل داده می‌شوند.
+func WithConsumer(name string) SubscribeOption {
+	return func(o *subscribeOptions) { o.consumer = name }
+}
+
+// StartFrom موقعیت شروع گروه را تعیین می‌کند: "0" کل stream، "$" فقط رویدادهای جدید (پیش‌فرض برای
+// گروه جدید) یا شناسه یک ورودی. اگر گروه از قبل وجود داشته باشد موقعیت آن به id برمی‌گردد تا
+// رویدادها دوباره پخش شوند.
+func StartFrom(id string) SubscribeOption {
+	return func(o *subscribeOptions) { o.start = id }
+}
+
+// WithBatchSize تعداد رویدادهای خوانده‌شده در هر درخواست را تعیین می‌کند (پیش‌فرض 100).
+func WithBatchSize(n int64) SubscribeOption {
+	return func(o *subscribeOptions) { o.batch = n }
+}
+
+// subscribeBlock حداکثر زمان انتظار هر XREADGROUP است تا لغو ctx به موقع دیده شود.
+const subscribeBlock = 2 * time.Second
+
+// Subscribe رویدادهای تغییر مدل را با consumer group داده‌شده دریافت می‌کند و هر رویداد را پس از
+// اجرای موفق handler تأیید (XACK) می‌کند. ابتدا رویدادهای تأییدنشده قبلی همین consumer پردازش
+// می‌شوند. Subscribe تا لغو ctx ادامه می‌دهد؛ اگر handler خطا برگرداند، رویداد تأیید نمی‌شود و
+// همان خطا برگردانده می‌شود.
+func (c *Client) Subscribe(ctx context.Context, model any, group string, handler func(context.Context, ChangeEvent) error, opts ...SubscribeOption) error {
+	meta, err := c.getModelMetadata(model)
+	if err != nil {
+		return err
+	}
+	if meta.Capture == nil {
+		return fmt.Errorf("%s does not capture changes; implement ChangeCapturer", meta.StructName)
+	}
+	if group == "" {
+		return errors.New("empty consumer group")
+	}
+	o := subscribeOptions{batch: 100}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.consumer == "" {
+		host, _ := os.Hostname()
+		o.consumer = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	stream := c.keyCDC(c.modelPrefix(meta))
+	start := o.start
+	if start == "" {
+		start = "$"
+	}
+	err = c.rdb.XGroupCreateMkStream(ctx, stream, group, start).Err()
+	if err != nil && strings.Contains(err.Error(), "BUSYGROUP") {
+		err = nil
+		if o.start != "" {
+			err = c.rdb.XGroupSetID(ctx, stream, group, o.start).Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	pending := true
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		args := &redis.XReadGroupArgs{Group: group, Consumer: o.consumer, Count: o.batch}
+		if pending {
+			args.Streams, args.Block = []string{stream, "0"}, -1
+		} else {
+			args.Streams, args.Block = []string{stream, ">"}, subscribeBlock
+		}
+		res, err := c.rdb.XReadGroup(ctx, args).Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var msgs []redis.XMessage
+		if len(res) > 0 {
+			msgs = res[0].Messages
+		}
+		if pending && len(msgs) == 0 {
+			pending = false
+			continue
+		}
+		for _, msg := range msgs {
+			if err := ctx.Err(); err != nil {
+				return err // رویدادهای باقی‌مانده تأییدنشده می‌مانند و دوباره تحویل داده می‌شوند
+			}
+			// ورودی‌هایی که با MaxLen از stream حذف شده‌اند فقط تأیید می‌شوند.
+			if len(msg.Values) > 0 {
+				ev, err := parseChangeEvent(msg)
+				if err != nil {
+					return err
+				}
+				if err := handler(ctx, ev); err != nil {
+					return err
+				}
+			}
+			// رویداد پردازش شده است؛ تأیید حتی پس از لغو ctx انجام می‌شود تا دوباره تحویل نشود.
+			if err := c.rdb.XAck(context.WithoutCancel(ctx), stream, group, msg.ID).Err(); err != nil {
+				return err
+			}
+		}
+	}
+}
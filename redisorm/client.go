@@ -3,15 +3,42 @@ package redisorm
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"sync"
 
 	"github.com/redis/go-redis/v9"
 )
 
 type Client struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 	ns  string // namespace
 	kek []byte // master key (KEK)
+	kid string // active master key id
+
+	keyring    bool // set by WithKeyring; keys are validated strictly
+	retired    []MasterKey
+	ring       *keyring
+	strictKeys bool
+
+	// strictDecrypt شکست رمزگشایی را به جای صفر کردن فیلد به صورت خطا برمی‌گرداند.
+	strictDecrypt  bool
+	onDecryptError func(*DecryptError)
+
+	// keyProvider در صورت تنظیم، رمزنگاری envelope (کلید داده برای هر رکورد) را فعال می‌کند.
+	keyProvider KeyProvider
+
+	// deriveKeys زیرکلیدهای رمزنگاری و blind index را با HKDF از کلید اصلی مشتق می‌کند.
+	deriveKeys bool
+
+	// hashTags پیشوند مدل را در {} قرار می‌دهد تا همه کلیدهای یک مدل در یک slot کلاستر قرار گیرند.
+	hashTags bool
+
+	// notify تغییرات رکوردها را برای Watch و WatchModel منتشر می‌کند.
+	notify bool
+
+	// مولدهای شناسه برای default:"ulid" و default:"snowflake".
+	ulid      ulidGen
+	snowflake snowflakeGen
 
 	// Lua scripts
 	luaSave             *redis.Script
@@ -19,13 +46,29 @@ type Client struct {
 	luaPayloadSave      *redis.Script
 	luaUnlock           *redis.Script
 	luaUpdateFieldsFast *redis.Script
+	luaQuery            *redis.Script
+	luaRotate           *redis.Script
+	luaSeedShadow       *redis.Script
+	luaReap             *redis.Script
+	luaRepairDrop       *redis.Script
+	luaRepairRecord     *redis.Script
+	luaTouch            *redis.Script
 
 	// Cache for model metadata to avoid repeated reflection
 	metaCache sync.Map
+
+	// registered مدل‌های ثبت‌شده با Register بر اساس پیشوند مدل است.
+	regMu      sync.Mutex
+	registered map[string]reflect.Type
 }
 
 var ErrVersionConflict = errors.New("version conflict")
 
+// ErrIndexKeysChanged زمانی برگردانده می‌شود که کلیدهای ایندکسی یا مالک کلیدهای یکتای یک رکورد
+// در همه تلاش‌ها بین خواندن و اجرای اسکریپت تغییر کنند (فقط در حالت کلاستر)؛ عملیات را می‌توان
+// دوباره اجرا کرد.
+var ErrIndexKeysChanged = errors.New("record index keys keep changing")
+
 type Option func(*Client)
 
 func WithNamespace(ns string) Option {
@@ -37,37 +80,83 @@ func WithNamespace(ns string) Option {
 }
 
 func WithMasterKey(kek []byte) Option {
-	return func(c *Client) { c.kek = kek }
+	return func(c *Client) {
+		c.kek = kek
+		c.kid = defaultKeyID
+		c.keyring = false
+		c.retired = nil
+	}
 }
 
-func New(rdb *redis.Client, opts ...Option) (*Client, error) {
+// WithHashTags حالت کلاستر را به صورت دستی فعال می‌کند. برای *redis.ClusterClient و *redis.Ring
+// این حالت به صورت خودکار فعال است؛ این گزینه برای wrapperها یا پروکسی‌های کلاستر کاربرد دارد.
+func WithHashTags() Option {
+	return func(c *Client) { c.hashTags = true }
+}
+
+// New یک کلاینت ORM می‌سازد. rdb می‌تواند هر redis.UniversalClient باشد
+// (Client، ClusterClient، Ring یا FailoverClient برای Sentinel).
+func New(rdb redis.UniversalClient, opts ...Option) (*Client, error) {
+	if rdb == nil {
+		return nil, errors.New("nil redis client")
+	}
 	c := &Client{rdb: rdb, ns: "orm"}
+	switch rdb.(type) {
+	case *redis.ClusterClient, *redis.Ring:
+		c.hashTags = true
+	}
 	for _, o := range opts {
 		o(c)
 	}
-	if l := len(c.kek); l != 16 && l != 24 && l != 32 {
+	if !c.keyring && !validKeyLen(c.kek) {
+		if c.strictKeys {
+			return nil, errors.New("master key is missing or invalid (must be 16, 24 or 32 bytes)")
+		}
 		key, err := randBytes(32)
 		if err != nil {
 			return nil, fmt.Errorf("generate runtime KEK: %w", err)
 		}
 		c.kek = key
+		c.kid = "runtime"
 	}
+	ring, err := newKeyring(MasterKey{ID: c.kid, Key: c.kek}, c.retired...)
+	if err != nil {
+		return nil, err
+	}
+	c.ring = ring
 	c.luaUnlock = redis.NewScript(luaUnlock)
-	c.luaSave = redis.NewScript(luaSave)
-	c.luaDelete = redis.NewScript(luaDelete)
+	c.luaSave = shadowScript(luaSave, c.hashTags)
+	c.luaDelete = shadowScript(luaDelete, c.hashTags)
 	c.luaPayloadSave = redis.NewScript(luaPayloadSave)
-	c.luaUpdateFieldsFast = redis.NewScript(luaUpdateFieldsFast)
+	c.luaUpdateFieldsFast = shadowScript(luaUpdateFieldsFast, c.hashTags)
+	c.luaQuery = redis.NewScript(luaQuery)
+	c.luaRotate = shadowScript(luaRotate, c.hashTags)
+	c.luaSeedShadow = redis.NewScript(luaSeedShadow)
+	c.luaReap = shadowScript(luaReap, c.hashTags)
+	c.luaRepairDrop = redis.NewScript(luaRepairDrop)
+	c.luaRepairRecord = shadowScript(luaRepairRecord, c.hashTags)
+	c.luaTouch = shadowScript(luaTouch, c.hashTags)
 	return c, nil
 }
 
-// >>>>>>>>> NEW: تابع کمکی برای ساخت پیشوند کلید <<<<<<<<<
-func (c *Client) modelPrefix(meta *ModelMetadata) string {
+// modelName نام کامل مدل (به همراه گروه) را بدون hash tag برمی‌گرداند.
+func (c *Client) modelName(meta *ModelMetadata) string {
 	if meta.GroupName != "" {
 		return fmt.Sprintf("%s:%s", meta.GroupName, meta.StructName)
 	}
 	return meta.StructName
 }
 
+// >>>>>>>>> NEW: تابع کمکی برای ساخت پیشوند کلید <<<<<<<<<
+// در حالت کلاستر پیشوند در {} قرار می‌گیرد تا تمام کلیدهایی که یک اسکریپت Lua
+// (luaSave، luaDelete، luaQuery و ...) لمس می‌کند در یک hash slot باشند.
+func (c *Client) modelPrefix(meta *ModelMetadata) string {
+	if c.hashTags {
+		return "{" + c.modelName(meta) + "}"
+	}
+	return c.modelName(meta)
+}
+
 // Key builders
 func (c *Client) keyVal(modelPrefix, id string) string { return fmt.Sprintf("%s:val:%s:%s", c.ns, modelPrefix, id) }
 func (c *Client) keyVer(modelPrefix, id string) string { return fmt.Sprintf("%s:ver:%s:%s", c.ns, modelPrefix, id) }
@@ -77,12 +166,26 @@ func (c *Client) keyIdx(modelPrefix, field, value string) string {
 func (c *Client) keyIdxEnc(modelPrefix, field, mac string) string {
 	return fmt.Sprintf("%s:idxenc:%s:%s:%s", c.ns, modelPrefix, field, mac)
 }
+func (c *Client) keyRange(modelPrefix, field string) string {
+	return fmt.Sprintf("%s:rng:%s:%s", c.ns, modelPrefix, field)
+}
 func (c *Client) keyUniq(modelPrefix, field, value string) string {
 	return fmt.Sprintf("%s:uniq:%s:%s:%s", c.ns, modelPrefix, field, value)
 }
+func (c *Client) keyUniqEnc(modelPrefix, field, mac string) string {
+	return fmt.Sprintf("%s:uniqenc:%s:%s:%s", c.ns, modelPrefix, field, mac)
+}
 func (c *Client) keyLock(modelPrefix, id string) string {
 	return fmt.Sprintf("%s:lock:%s:%s", c.ns, modelPrefix, id)
 }
 func (c *Client) keyPayload(modelPrefix, id string) string {
 	return fmt.Sprintf("%s:pl:%s:%s", c.ns, modelPrefix, id)
+}
+// keyPattern الگوی SCAN برای همه کلیدهای یک نوع (val، idx، ...) از یک مدل است. Register
+// پیشوندهایی را که یکی گروه دیگری باشد نمی‌پذیرد تا این الگو کلیدهای مدل دیگری را در بر نگیرد.
+func (c *Client) keyPattern(kind, modelPrefix string) string {
+	return globEscape(fmt.Sprintf("%s:%s:%s:", c.ns, kind, modelPrefix)) + "*"
+}
+func (c *Client) keyTmp(modelPrefix, token string) string {
+	return fmt.Sprintf("%s:tmp:%s:%s", c.ns, modelPrefix, token)
 }
\ No newline at end of file
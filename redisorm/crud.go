@@ -6,18 +6,25 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-func (c *Client) prepareSaveInternal(ctx context.Context, v any, expectedVersion any, ttl ...time.Duration) (string, []string, []interface{}, error) {
-	meta, err := c.getModelMetadata(v)
-	if err != nil {
-		return "", nil, nil, err
-	}
+// savePlan کلیدها و آرگومان‌های آماده luaSave برای یک رکورد است.
+type savePlan struct {
+	id   string
+	keys []string
+	argv []interface{}
+	uniq []string // کلیدهای یکتای جدید که مالک فعلی آن‌ها باید پیش از اجرا خوانده شود
+	// versioned یعنی نسخه رکورد داخل luaSave تعیین می‌شود و باید پس از اجرا در struct قرار گیرد.
+	versioned bool
+}
 
+func (c *Client) prepareSaveInternal(ctx context.Context, meta *ModelMetadata, v any, expectedVersion any, ttl ...time.Duration) (*savePlan, error) {
 	isNew := false
 	id, err := readPrimaryKey(v, meta)
 	if err != nil || id == "" {
@@ -27,11 +34,15 @@ func (c *Client) prepareSaveInternal(ctx context.Context, v any, expectedVersion
 	if d, ok := v.(Defaultable); ok {
 		d.SetDefaults()
 	}
+	seqFloor, err := c.generateIDs(ctx, v, meta)
+	if err != nil {
+		return nil, err
+	}
 	applyDefaults(v, meta)
 
 	id, err = ensurePrimaryKey(v, meta)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, err
 	}
 
 	applyLifecycleHooks(v, meta, isNew)
@@ -42,34 +53,41 @@ func (c *Client) prepareSaveInternal(ctx context.Context, v any, expectedVersion
 
 	plain, err := json.Marshal(v)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("marshal plain: %w", err)
+		return nil, fmt.Errorf("marshal plain: %w", err)
 	}
-	newIdx := extractIndexable(v, plain, meta)
-	newUniq := extractUnique(v, plain, meta)
-	newIdxEnc := extractEncIndex(c, v, plain, meta)
+	// کلیدهای قبلی از shadow رکورد و داخل luaSave حذف می‌شوند.
+	names := slotNames(meta)
+	slots := c.indexSlots(meta, modelPrefix, TenantFrom(ctx), plain)
+	slotKeys, slotSpecs := slotArgs(names, slots)
+	guardKeys, guardSpecs := c.uniqueGuards(meta, modelPrefix, TenantFrom(ctx), plain, names)
+	slotKeys, slotSpecs = append(slotKeys, guardKeys...), append(slotSpecs, guardSpecs...)
 
-	var oldIdx, oldUniq, oldIdxEnc map[string]string
-	if encOld, _ := c.rdb.Get(ctx, valKey).Result(); encOld != "" {
-		if oldPlain, _ := c.decryptForType(ctx, meta, encOld); len(oldPlain) > 0 {
-			oldIdx = extractIndexable(v, oldPlain, meta)
-			oldUniq = extractUnique(v, oldPlain, meta)
-			oldIdxEnc = extractEncIndex(c, v, oldPlain, meta)
-		}
-	}
-
-	encMap, err := c.buildEncryptedMap(ctx, v, meta)
+	encMap, err := c.buildEncryptedMap(ctx, v, meta, id)
 	if err != nil {
-		return "", nil, nil, err
+		return nil, err
+	}
+	// در مدل‌های دارای تاریخچه، luaSave نسخه جدید را به جای این نشانگر قرار می‌دهد.
+	versioned := meta.HistorySize > 0 && expectedVersion == "" && len(meta.VersionFields) > 0
+	if versioned {
+		encMap[meta.JsonNames[meta.VersionFields[0]]] = versionPlaceholder
 	}
 	encJSON, err := json.Marshal(encMap)
 	if err != nil {
-		return "", nil, nil, fmt.Errorf("marshal enc: %w", err)
+		return nil, fmt.Errorf("marshal enc: %w", err)
+	}
+
+	scores := extractRange(v, meta)
+	var addRange, remRange []string
+	var rangeScores []interface{}
+	for _, fieldName := range meta.RangeFields {
+		if score, ok := scores[fieldName]; ok {
+			addRange = append(addRange, c.keyRange(modelPrefix, fieldName))
+			rangeScores = append(rangeScores, formatScore(score))
+		} else {
+			remRange = append(remRange, c.keyRange(modelPrefix, fieldName))
+		}
 	}
 
-	addUniq, delUniq := diffUniqueKeys(c, modelPrefix, newUniq, oldUniq)
-	addIdx, remIdx := diffIndexKeys(c, modelPrefix, newIdx, oldIdx)
-	addIdxEnc, remIdxEnc := diffEncIndexKeys(c, modelPrefix, newIdxEnc, oldIdxEnc)
-
 	// >>>>>>>>> MODIFIED: منطق جدید برای تعیین TTL <<<<<<<<<
 	var exp time.Duration
 	if len(ttl) > 0 {
@@ -80,24 +98,27 @@ func (c *Client) prepareSaveInternal(ctx context.Context, v any, expectedVersion
 		exp = meta.AutoDeleteTTL
 	}
 
-	keys := make([]string, 0, 2+len(addUniq)+len(delUniq)+len(addIdx)+len(remIdx)+len(addIdxEnc)+len(remIdxEnc))
-	keys = append(keys, verKey, valKey)
-	keys = append(keys, addUniq...)
-	keys = append(keys, delUniq...)
-	keys = append(keys, addIdx...)
-	keys = append(keys, remIdx...)
-	keys = append(keys, addIdxEnc...)
-	keys = append(keys, remIdxEnc...)
+	keys := make([]string, 0, 8+len(slotKeys)+len(addRange)+len(remRange))
+	keys = append(keys, verKey, valKey, c.keyShadow(modelPrefix, id), c.keyCDC(modelPrefix), c.keyHistory(modelPrefix, id))
+	keys = append(keys, c.auditKeys(ctx, modelPrefix, id)...)
+	keys = append(keys, c.keySeq(modelPrefix))
+	keys = append(keys, slotKeys...)
+	keys = append(keys, addRange...)
+	keys = append(keys, remRange...)
 
 	argv := []interface{}{
 		id, string(encJSON), int64(exp.Milliseconds()),
 		expectedVersion,
-		len(addUniq), len(delUniq),
-		len(addIdx), len(remIdx),
-		len(addIdxEnc), len(remIdxEnc),
+		len(slotSpecs), len(addRange), len(remRange),
 	}
+	argv = append(argv, c.changeArgs(meta, modelPrefix, id)...)
+	argv = append(argv, meta.HistorySize)
+	argv = append(argv, c.auditArgs(ctx, meta)...)
+	argv = append(argv, seqFloor)
+	argv = append(argv, slotSpecs...)
+	argv = append(argv, rangeScores...)
 
-	return id, keys, argv, nil
+	return &savePlan{id: id, keys: keys, argv: argv, uniq: append(uniqKeys(names, slots), guardKeys...), versioned: versioned}, nil
 }
 
 // ... (سایر توابع فایل بدون تغییر باقی می‌مانند) ...
@@ -105,16 +126,39 @@ func (c *Client) Save(ctx context.Context, v any, ttl ...time.Duration) (string,
 	if v == nil {
 		return "", errors.New("nil value")
 	}
-	id, keys, argv, err := c.prepareSaveInternal(ctx, v, "", ttl...)
+	meta, err := c.getModelMetadata(v)
+	if err != nil {
+		return "", err
+	}
+	return c.save(ctx, meta, v, ttl...)
+}
+
+func (c *Client) save(ctx context.Context, meta *ModelMetadata, v any, ttl ...time.Duration) (string, error) {
+	plan, err := c.prepareSaveInternal(ctx, meta, v, "", ttl...)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = c.luaSave.Run(ctx, c.rdb, keys, argv...).Result()
+	ver, err := c.runSave(ctx, meta, plan)
 	if err != nil {
 		return "", err
 	}
-	return id, nil
+	if plan.versioned {
+		setVersion(v, ver)
+	}
+	return plan.id, nil
+}
+
+// runSave اسکریپت luaSave را با کلیدهای فعلی رکورد اجرا می‌کند و در صورت نیاز ابتدا shadow
+// رکوردهای قدیمی را می‌سازد. نسخه رکورد پس از نوشتن برگردانده می‌شود.
+func (c *Client) runSave(ctx context.Context, meta *ModelMetadata, plan *savePlan) (int64, error) {
+	var ver int64
+	err := c.withShadow(ctx, meta, c.modelPrefix(meta), plan.id, plan.uniq, func(current []string) error {
+		var err error
+		ver, err = c.luaSave.Run(ctx, c.rdb, append(slices.Clip(plan.keys), current...), plan.argv...).Int64()
+		return err
+	})
+	return ver, err
 }
 
 func (c *Client) SaveAll(ctx context.Context, slice any) ([]string, error) {
@@ -127,31 +171,58 @@ func (c *Client) SaveAll(ctx context.Context, slice any) ([]string, error) {
 		return []string{}, nil
 	}
 
-	pipe := c.rdb.Pipeline()
 	ids := make([]string, count)
-	cmds := make([]*redis.Cmd, count)
+	plans := make([]*savePlan, count)
+	current := make([]func() []string, count)
 
+	// کلیدهای فعلی همه رکوردها در یک رفت‌وبرگشت خوانده می‌شوند.
+	read := c.rdb.Pipeline()
 	for i := 0; i < count; i++ {
 		v := rv.Index(i).Interface()
-		id, keys, argv, err := c.prepareSaveInternal(ctx, v, "")
+		meta, err := c.getModelMetadata(v)
+		if err != nil {
+			return nil, fmt.Errorf("error preparing item %d: %w", i, err)
+		}
+		plan, err := c.prepareSaveInternal(ctx, meta, v, "")
 		if err != nil {
 			return nil, fmt.Errorf("error preparing item %d: %w", i, err)
 		}
-		ids[i] = id
-		cmds[i] = c.luaSave.Run(ctx, pipe, keys, argv...)
+		ids[i], plans[i] = plan.id, plan
+		current[i] = c.queueCurrentKeys(ctx, read, c.modelPrefix(meta), plan.id, plan.uniq)
+	}
+	if _, err := read.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("pipeline execution failed: %w", err)
 	}
 
-	if _, err := pipe.Exec(ctx); err != nil {
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.Cmd, count)
+	for i, plan := range plans {
+		cmds[i] = c.luaSave.Run(ctx, pipe, append(slices.Clip(plan.keys), current[i]()...), plan.argv...)
+	}
+
+	// خطاهای Redis (مانند UNIQUE_CONFLICT) برای هر آیتم جداگانه بررسی می‌شوند.
+	var rerr redis.Error
+	if _, err := pipe.Exec(ctx); err != nil && !errors.As(err, &rerr) {
 		return nil, fmt.Errorf("pipeline execution failed: %w", err)
 	}
 
 	for i, cmd := range cmds {
-		if err := cmd.Err(); err != nil {
+		ver, err := cmd.Int64()
+		if isNoShadow(err) || isStaleKeys(err) {
+			// رکورد پیش از معرفی shadowها نوشته شده یا کلیدهای آن همزمان تغییر کرده است؛
+			// جداگانه دوباره ذخیره می‌شود.
+			meta, _ := c.getModelMetadata(rv.Index(i).Interface())
+			ver, err = c.runSave(ctx, meta, plans[i])
+		}
+		if err != nil {
 			if strings.Contains(err.Error(), "UNIQUE_CONFLICT") {
 				return nil, fmt.Errorf("unique constraint violation on item %d (id: %s)", i, ids[i])
 			}
 			return nil, fmt.Errorf("failed to save item %d (id: %s): %w", i, ids[i], err)
 		}
+		if plans[i].versioned {
+			setVersion(rv.Index(i).Interface(), ver)
+		}
 	}
 
 	return ids, nil
@@ -161,19 +232,27 @@ func (c *Client) SaveOptimistic(ctx context.Context, v any, ttl ...time.Duration
 	if v == nil {
 		return "", errors.New("nil value")
 	}
-	vp, _ := versionPointer(v)
+	meta, err := c.getModelMetadata(v)
+	if err != nil {
+		return "", err
+	}
+	return c.saveOptimistic(ctx, meta, v, ttl...)
+}
+
+func (c *Client) saveOptimistic(ctx context.Context, meta *ModelMetadata, v any, ttl ...time.Duration) (string, error) {
+	vp := versionPointer(v)
 	if vp == nil {
 		return "", errors.New("no Version int64 field for optimistic save")
 	}
 	expectedVersion := *vp
 	setVersion(v, expectedVersion+1)
 
-	id, keys, argv, err := c.prepareSaveInternal(ctx, v, expectedVersion, ttl...)
+	plan, err := c.prepareSaveInternal(ctx, meta, v, expectedVersion, ttl...)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = c.luaSave.Run(ctx, c.rdb, keys, argv...).Result()
+	_, err = c.runSave(ctx, meta, plan)
 	if err != nil {
 		if strings.Contains(err.Error(), "VERSION_CONFLICT") {
 			return "", ErrVersionConflict
@@ -183,10 +262,12 @@ func (c *Client) SaveOptimistic(ctx context.Context, v any, ttl ...time.Duration
 		}
 		return "", err
 	}
-	return id, nil
+	return plan.id, nil
 }
 
-func (c *Client) Load(ctx context.Context, dst any, id string) error {
+// Load رکورد را در dst می‌خواند. id می‌تواند شناسه رشته‌ای، Key (اجزای کلید ترکیبی به ترتیب)،
+// مقدار کلید اصلی یا struct مدل با فیلدهای pk پرشده باشد؛ اگر خالی باشد کلید از خود dst خوانده می‌شود.
+func (c *Client) Load(ctx context.Context, dst any, id any) error {
 	if dst == nil {
 		return errors.New("nil dst")
 	}
@@ -194,60 +275,66 @@ func (c *Client) Load(ctx context.Context, dst any, id string) error {
 	if err != nil {
 		return err
 	}
-	if id == "" {
-		id, err = readPrimaryKey(dst, meta)
-		if err != nil || id == "" {
-			return errors.New("empty pk for Load")
-		}
+	key, err := recordID(meta, dst, id)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("empty pk for Load")
 	}
+	return c.load(ctx, meta, dst, key, c.strictDecrypt)
+}
+
+// load رکورد را در dst می‌خواند. مسیرهایی که رکورد را دوباره ذخیره می‌کنند strict را true می‌دهند
+// تا فیلد محرمانه‌ای که رمزگشایی نشده با مقدار صفر بازنویسی نشود.
+func (c *Client) load(ctx context.Context, meta *ModelMetadata, dst any, id string, strict bool) error {
 	modelPrefix := c.modelPrefix(meta)
 	valKey := c.keyVal(modelPrefix, id)
 	encJSON, err := c.rdb.Get(ctx, valKey).Result()
 	if err != nil {
 		return err
 	}
-	plain, err := c.decryptForType(ctx, meta, encJSON)
+	plain, err := c.decryptDoc(ctx, meta, id, encJSON, strict)
 	if err != nil {
 		return err
 	}
 	return json.Unmarshal(plain, dst)
 }
 
-func (c *Client) Delete(ctx context.Context, v any, id string) error {
+// Delete رکورد را حذف می‌کند؛ id مانند Load تعیین می‌شود.
+func (c *Client) Delete(ctx context.Context, v any, id any) error {
 	meta, err := c.getModelMetadata(v)
 	if err != nil {
 		return err
 	}
-	if id == "" {
-		id, err = readPrimaryKey(v, meta)
-		if err != nil || id == "" {
-			return errors.New("empty pk for Delete")
-		}
+	key, err := recordID(meta, v, id)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("empty pk for Delete")
 	}
+	return c.delete(ctx, meta, v, key)
+}
 
+func (c *Client) delete(ctx context.Context, meta *ModelMetadata, v any, id string) error {
 	modelPrefix := c.modelPrefix(meta)
-	valKey := c.keyVal(modelPrefix, id)
-	verKey := c.keyVer(modelPrefix, id)
-
-	var oldIdx, oldUniq, oldIdxEnc map[string]string
-	if encJSON, _ := c.rdb.Get(ctx, valKey).Result(); encJSON != "" {
-		if plain, _ := c.decryptForType(ctx, meta, encJSON); len(plain) > 0 {
-			oldIdx = extractIndexable(v, plain, meta)
-			oldUniq = extractUnique(v, plain, meta)
-			oldIdxEnc = extractEncIndex(c, v, plain, meta)
-		}
-	}
-	delUniq := keysFromMap(c, modelPrefix, oldUniq, func(prefix, field, val string) string { return c.keyUniq(prefix, field, val) })
-	remIdx := keysFromMap(c, modelPrefix, oldIdx, func(prefix, field, val string) string { return c.keyIdx(prefix, field, val) })
-	remIdxEnc := keysFromMap(c, modelPrefix, oldIdxEnc, func(prefix, field, mac string) string { return c.keyIdxEnc(prefix, field, mac) })
-	keys := make([]string, 0, 2+len(delUniq)+len(remIdx)+len(remIdxEnc))
-	keys = append(keys, verKey, valKey)
-	keys = append(keys, delUniq...)
-	keys = append(keys, remIdx...)
-	keys = append(keys, remIdxEnc...)
-	argv := []interface{}{id, "", 1, len(delUniq), len(remIdx), len(remIdxEnc)}
-	_, err = c.luaDelete.Run(ctx, c.rdb, keys, argv...).Result()
-	return err
+	// کلیدهای ایندکس و یکتای رکورد از shadow آن و داخل luaDelete حذف می‌شوند.
+	keys := []string{c.keyVer(modelPrefix, id), c.keyVal(modelPrefix, id), c.keyShadow(modelPrefix, id), c.keyCDC(modelPrefix), c.keyHistory(modelPrefix, id)}
+	keys = append(keys, c.auditKeys(ctx, modelPrefix, id)...)
+	for _, fieldName := range meta.RangeFields {
+		keys = append(keys, c.keyRange(modelPrefix, fieldName))
+	}
+	hasSlots := 0
+	if len(slotNames(meta)) > 0 {
+		hasSlots = 1
+	}
+	argv := append([]interface{}{id, "", 1, hasSlots}, c.changeArgs(meta, modelPrefix, id)...)
+	argv = append(argv, c.auditArgs(ctx, meta)...)
+	argv = append(argv, len(meta.RangeFields))
+	return c.withShadow(ctx, meta, modelPrefix, id, nil, func(current []string) error {
+		return c.luaDelete.Run(ctx, c.rdb, append(slices.Clip(keys), current...), argv...).Err()
+	})
 }
 
 func (c *Client) UpdateFields(ctx context.Context, dst any, id string, updates map[string]any) (string, error) {
@@ -261,51 +348,146 @@ func (c *Client) UpdateFields(ctx context.Context, dst any, id string, updates m
 			return "", errors.New("empty pk for UpdateFields")
 		}
 	}
-	if err := c.Load(ctx, dst, id); err != nil {
+	if err := c.load(ctx, meta, dst, id, true); err != nil {
 		return "", err
 	}
 	applyUpdatesByJSONName(dst, updates)
 	return c.Save(ctx, dst)
 }
 
-func (c *Client) UpdateFieldsFast(ctx context.Context, sample any, id string, updates map[string]any) error {
+// UpdateFieldsFast فیلدها را (بر اساس نام JSON) بدون بارگذاری کامل شیء در یک اسکریپت Lua به‌روز می‌کند.
+// ایندکس‌ها، قیدهای یکتا و ایندکس‌های بازه‌ای فیلدهای تغییرکرده، نسخه (کلید ver و فیلد version) و
+// فیلدهای auto_update_time در همان اسکریپت به‌روز می‌شوند و TTL رکورد حفظ می‌شود. نام JSON فیلدهایی
+// که مقدارشان واقعاً تغییر کرده برگردانده می‌شود (فیلدهای secret همیشه تغییرکرده محسوب می‌شوند)؛
+// اگر هیچ فیلدی تغییر نکند چیزی نوشته نمی‌شود.
+func (c *Client) UpdateFieldsFast(ctx context.Context, sample any, id string, updates map[string]any, opts ...UpdateOption) ([]string, error) {
 	meta, err := c.getModelMetadata(sample)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if id == "" {
-		return errors.New("empty id for UpdateFieldsFast")
+		return nil, errors.New("empty id for UpdateFieldsFast")
+	}
+	var o updateOptions
+	for _, opt := range opts {
+		opt(&o)
 	}
 	modelPrefix := c.modelPrefix(meta)
 	valKey := c.keyVal(modelPrefix, id)
-	encryptedUpdates, err := c.encryptUpdateMap(ctx, meta, updates)
+	verKey := c.keyVer(modelPrefix, id)
+	encryptedUpdates, err := c.encryptUpdateMap(ctx, meta, id, updates)
 	if err != nil {
-		return fmt.Errorf("could not encrypt updates: %w", err)
+		return nil, fmt.Errorf("could not encrypt updates: %w", err)
 	}
 	updatesJson, err := json.Marshal(encryptedUpdates)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	_, err = c.luaUpdateFieldsFast.Run(ctx, c.rdb, []string{valKey}, string(updatesJson)).Result()
-	if err != nil {
-		if strings.Contains(err.Error(), "NOT_FOUND") {
-			return redis.Nil
+
+	auto := map[string]any{}
+	now := time.Now().UTC()
+	for _, fieldName := range meta.AutoUpdateTimeFields {
+		if _, ok := updates[meta.JsonNames[fieldName]]; !ok {
+			auto[meta.JsonNames[fieldName]] = now
 		}
+	}
+	if t := TenantFrom(ctx); t != "" {
+		auto[tenantField] = t
+	}
+	autoJson, err := json.Marshal(auto)
+	if err != nil {
+		return nil, err
+	}
+	versionField := ""
+	if len(meta.VersionFields) > 0 {
+		versionField = meta.JsonNames[meta.VersionFields[0]]
+	}
+	expected := ""
+	if o.expectVersion != nil {
+		expected = strconv.FormatInt(*o.expectVersion, 10)
+	}
+
+	plan, err := c.planFastUpdate(ctx, meta, sample, modelPrefix, id, updates, auto)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{valKey, verKey, c.keyShadow(modelPrefix, id), c.keyCDC(modelPrefix), c.keyHistory(modelPrefix, id)}
+	keys = append(append(keys, c.auditKeys(ctx, modelPrefix, id)...), plan.keys...)
+	argv := []interface{}{string(updatesJson), expected, versionField, string(autoJson), id}
+	argv = append(argv, plan.argv...)
+
+	var changed []string
+	err = c.withShadow(ctx, meta, modelPrefix, id, plan.uniq, func(current []string) error {
+		var err error
+		changed, err = c.luaUpdateFieldsFast.Run(ctx, c.rdb, append(slices.Clip(keys), current...), argv...).StringSlice()
 		return err
+	})
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "NOT_FOUND"):
+			return nil, redis.Nil
+		case strings.Contains(err.Error(), "VERSION_CONFLICT"):
+			return nil, ErrVersionConflict
+		case strings.Contains(err.Error(), "UNIQUE_CONFLICT"):
+			return nil, fmt.Errorf("unique constraint violation")
+		}
+		return nil, err
 	}
-	return nil
+	return changed, nil
 }
 
-func (c *Client) Exists(ctx context.Context, sample any, id string) (bool, error) {
+// Exists وجود رکورد را بررسی می‌کند؛ id مانند Load تعیین می‌شود.
+func (c *Client) Exists(ctx context.Context, sample any, id any) (bool, error) {
 	meta, err := c.getModelMetadata(sample)
 	if err != nil {
 		return false, err
 	}
-	if id == "" {
+	key, err := recordID(meta, sample, id)
+	if err != nil {
+		return false, err
+	}
+	if key == "" {
 		return false, errors.New("empty id")
 	}
+	return c.exists(ctx, meta, key)
+}
+
+func (c *Client) exists(ctx context.Context, meta *ModelMetadata, id string) (bool, error) {
 	modelPrefix := c.modelPrefix(meta)
-	return c.rdb.Exists(ctx, c.keyVal(modelPrefix, id)).Val() == 1, nil
+	n, err := c.rdb.Exists(ctx, c.keyVal(modelPrefix, id)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// loadMany اسناد رمزگشایی‌شده را با یک MGET برمی‌گرداند؛ برای شناسه‌های ناموجود مقدار nil است.
+func (c *Client) loadMany(ctx context.Context, meta *ModelMetadata, ids []string) ([][]byte, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	modelPrefix := c.modelPrefix(meta)
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = c.keyVal(modelPrefix, id)
+	}
+	vals, err := c.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, len(ids))
+	for i, raw := range vals {
+		encJSON, ok := raw.(string)
+		if !ok {
+			continue
+		}
+		plain, err := c.decryptForType(ctx, meta, ids[i], encJSON)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = plain
+	}
+	return out, nil
 }
 
 func (c *Client) PageIDsByIndex(ctx context.Context, sample any, field, value string, cursor uint64, count int64) ([]string, uint64, error) {
@@ -324,13 +506,31 @@ func (c *Client) PageIDsByEncIndex(ctx context.Context, sample any, field, plain
 	if err != nil {
 		return nil, 0, err
 	}
-	mac := macString(c.kek, plainValue)
+	mac := c.blindIndex(meta, TenantFrom(ctx), plainValue)
 	modelPrefix := c.modelPrefix(meta)
 	key := c.keyIdxEnc(modelPrefix, field, mac)
 	ids, next, err := c.rdb.SScan(ctx, key, cursor, "", count).Result()
 	return ids, next, err
 }
 
+// FindByUniqueEnc شناسه رکوردی را برمی‌گرداند که مقدار ساده plainValue در فیلد unique_enc آن
+// ثبت شده است؛ اگر رکوردی وجود نداشته باشد redis.Nil برگردانده می‌شود.
+func (c *Client) FindByUniqueEnc(ctx context.Context, sample any, field, plainValue string) (string, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return "", err
+	}
+	return c.findByUniqueEnc(ctx, meta, field, plainValue)
+}
+
+func (c *Client) findByUniqueEnc(ctx context.Context, meta *ModelMetadata, field, plainValue string) (string, error) {
+	if !slices.Contains(meta.EncUniqueFields, field) {
+		return "", fmt.Errorf("field %s is not unique_enc", field)
+	}
+	mac := c.blindIndex(meta, TenantFrom(ctx), plainValue)
+	return c.rdb.Get(ctx, c.keyUniqEnc(c.modelPrefix(meta), field, mac)).Result()
+}
+
 func (c *Client) SavePayload(ctx context.Context, sample any, id string, payload any, encrypt bool, ttl ...time.Duration) error {
 	if id == "" {
 		return errors.New("empty id")
@@ -346,7 +546,7 @@ func (c *Client) SavePayload(ctx context.Context, sample any, id string, payload
 		return err
 	}
 	if encrypt {
-		ct, err := aesGCMEncrypt(c.kek, bs)
+		ct, err := c.newSealer(ctx, "pl", meta, id, "").seal(payloadField, bs)
 		if err != nil {
 			return err
 		}
@@ -374,8 +574,8 @@ func (c *Client) GetPayload(ctx context.Context, sample any, id string, decrypt
 	if err != nil {
 		return nil, err
 	}
-	if decrypt && strings.HasPrefix(val, fieldEncPrefix) {
-		plain, err := aesGCMDecrypt(c.kek, val)
+	if decrypt && isCiphertext(val) {
+		plain, err := c.newOpener(ctx, "pl", meta, id).open(payloadField, val)
 		if err != nil {
 			return nil, err
 		}
@@ -384,6 +584,7 @@ func (c *Client) GetPayload(ctx context.Context, sample any, id string, decrypt
 	return []byte(val), nil
 }
 
+// Touch زمان انقضای رکورد و کلیدهای یکتای آن را تمدید می‌کند.
 func (c *Client) Touch(ctx context.Context, sample any, id string, ttl time.Duration) error {
 	if id == "" {
 		return errors.New("empty id")
@@ -399,15 +600,23 @@ func (c *Client) Touch(ctx context.Context, sample any, id string, ttl time.Dura
 		return err
 	}
 	modelPrefix := c.modelPrefix(meta)
-	key := c.keyVal(modelPrefix, id)
-	exists, err := c.rdb.Exists(ctx, key).Result()
+	keys := []string{c.keyVal(modelPrefix, id), c.keyShadow(modelPrefix, id)}
+	hasSlots := 0
+	if len(meta.UniqueFields) > 0 || len(meta.EncUniqueFields) > 0 {
+		hasSlots = 1
+	}
+	var touched int
+	err = c.withShadow(ctx, meta, modelPrefix, id, nil, func(current []string) error {
+		touched, err = c.luaTouch.Run(ctx, c.rdb, append(slices.Clip(keys), current...), id, max(ttl.Milliseconds(), 1), hasSlots).Int()
+		return err
+	})
 	if err != nil {
 		return err
 	}
-	if exists == 0 {
+	if touched == 0 {
 		return redis.Nil
 	}
-	return c.rdb.Expire(ctx, key, ttl).Err()
+	return nil
 }
 
 func (c *Client) TouchPayload(ctx context.Context, sample any, id string, ttl time.Duration) error {
@@ -7,11 +7,43 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"strings"
 )
 
-const fieldEncPrefix = "encf:v1:gcm:"
+// قالب‌های مقدار رمز‌شده:
+//
+//	encf:v1:gcm:<kid>:<base64(nonce|ct)>      رمز مستقیم با کلید اصلی kid
+//	encf:v1:gcm:<base64(nonce|ct)>            قالب قدیمی بدون شناسه کلید
+//	encf:v1:env:<base64(wrapped)>:<base64(nonce|ct)>  envelope با کلید داده رکورد
+//
+// قالب‌های v2 همان ساختار را دارند اما ciphertext با AAD (فضای نام، مدل، شناسه رکورد و
+// نام فیلد) به رکورد و فیلد خود گره خورده است؛ مقادیر v1 همچنان خوانده می‌شوند.
+// قالب v3 مانند v2 است اما با زیرکلید مشتق‌شده (HKDF) مدل و tenant رمز شده و tenant (base64url)
+// پس از شناسه کلید در آن درج می‌شود: encf:v3:gcm:<kid>:<tenant>:<base64>.
+const (
+	encPrefix        = "encf:"
+	fieldEncPrefix   = "encf:v1:gcm:"
+	envEncPrefix     = "encf:v1:env:"
+	fieldEncPrefixV2 = "encf:v2:gcm:"
+	envEncPrefixV2   = "encf:v2:env:"
+	fieldEncPrefixV3 = "encf:v3:gcm:"
+)
+
+// isCiphertext گزارش می‌دهد که آیا رشته در یکی از قالب‌های رمز‌شده ORM است.
+func isCiphertext(s string) bool { return strings.HasPrefix(s, encPrefix) }
+
+// recordAAD داده احرازشده یک فیلد محرمانه را می‌سازد. هر جزء با طولش پیشوند می‌شود
+// تا ترکیب‌های مختلف به یک رشته یکسان نرسند.
+func recordAAD(parts ...string) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = binary.AppendUvarint(out, uint64(len(p)))
+		out = append(out, p...)
+	}
+	return out
+}
 
 func randBytes(n int) ([]byte, error) {
 	b := make([]byte, n)
@@ -26,29 +58,57 @@ func macString(kek []byte, s string) string {
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
-func aesGCMEncrypt(key, plain []byte) (string, error) {
-	bc, err := aes.NewCipher(key)
+// aesGCMSeal مقدار را رمز کرده و شناسه کلید را پس از prefix در ciphertext درج می‌کند.
+func aesGCMSeal(prefix, kid string, key, plain, aad []byte) (string, error) {
+	raw, err := gcmSeal(key, plain, aad)
 	if err != nil {
 		return "", err
 	}
+	return prefix + kid + ":" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// splitKeyID شناسه کلید و بدنه base64 را از ciphertext جدا می‌کند. برای مقادیر قدیمی
+// kid خالی است. الفبای base64 شامل ':' نیست، پس وجود آن به معنای وجود شناسه کلید است.
+func splitKeyID(enc string) (kid, body string, ver int, err error) {
+	switch {
+	case strings.HasPrefix(enc, fieldEncPrefixV3):
+		body, ver = enc[len(fieldEncPrefixV3):], 3
+	case strings.HasPrefix(enc, fieldEncPrefixV2):
+		body, ver = enc[len(fieldEncPrefixV2):], 2
+	case strings.HasPrefix(enc, fieldEncPrefix):
+		body, ver = enc[len(fieldEncPrefix):], 1
+	default:
+		return "", "", 0, errors.New("invalid ciphertext prefix")
+	}
+	if kid, payload, ok := strings.Cut(body, ":"); ok {
+		return kid, payload, ver, nil
+	}
+	if ver > 1 {
+		return "", "", 0, errors.New("missing key id")
+	}
+	return "", body, ver, nil
+}
+
+// gcmSeal خروجی nonce|ct را برمی‌گرداند.
+func gcmSeal(key, plain, aad []byte) ([]byte, error) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
 	gcm, err := cipher.NewGCM(bc)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	nonce, err := randBytes(gcm.NonceSize())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	ct := gcm.Seal(nil, nonce, plain, nil)
-	out := append(nonce, ct...)
-	return fieldEncPrefix + base64.StdEncoding.EncodeToString(out), nil
+	return gcm.Seal(nonce, nonce, plain, aad), nil
 }
 
-func aesGCMDecrypt(key []byte, enc string) ([]byte, error) {
-	if !strings.HasPrefix(enc, fieldEncPrefix) {
-		return nil, errors.New("invalid ciphertext prefix")
-	}
-	raw, err := base64.StdEncoding.DecodeString(enc[len(fieldEncPrefix):])
+// gcmOpen مقدار base64(nonce|ct) را با aad داده‌شده باز می‌کند.
+func gcmOpen(key []byte, b64 string, aad []byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(b64)
 	if err != nil {
 		return nil, err
 	}
@@ -64,6 +124,5 @@ func aesGCMDecrypt(key []byte, enc string) ([]byte, error) {
 	if len(raw) < ns {
 		return nil, errors.New("ciphertext too short")
 	}
-	nonce, ct := raw[:ns], raw[ns:]
-	return gcm.Open(nil, nonce, ct, nil)
+	return gcm.Open(nil, raw[:ns], raw[ns:], aad)
 }
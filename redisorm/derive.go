@@ -0,0 +1,112 @@
+package redisorm
+
+import (
+	"context"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/json"
+)
+
+// کاربرد زیرکلیدهای مشتق‌شده از کلید اصلی.
+const (
+	subkeyEnc = "enc" // رمزنگاری فیلدهای محرمانه
+	subkeyIdx = "idx" // HMAC ایندکس‌های index_enc (blind index)
+)
+
+// WithKeyDerivation به جای استفاده مستقیم از کلید اصلی، زیرکلیدهای مستقل با HKDF-SHA256
+// می‌سازد: یک زیرکلید رمزنگاری و یک زیرکلید blind index برای هر مدل (و هر tenant در صورت
+// استفاده از WithTenant). داده‌های موجود همچنان خوانده می‌شوند و RotateKeys آن‌ها را به قالب
+// جدید منتقل و مجموعه‌های index_enc را با زیرکلید جدید بازسازی می‌کند.
+func WithKeyDerivation() Option {
+	return func(c *Client) { c.deriveKeys = true }
+}
+
+type tenantCtxKey struct{}
+
+// WithTenant شناسه tenant را به context اضافه می‌کند. در حالت WithKeyDerivation فیلدهای محرمانه
+// و blind indexهای رکوردهایی که با این context ذخیره می‌شوند با زیرکلیدهای همان tenant ساخته
+// می‌شوند و جست‌وجوی index_enc فقط رکوردهای همان tenant را می‌یابد.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, tenant)
+}
+
+// TenantFrom شناسه tenant موجود در context را برمی‌گرداند.
+func TenantFrom(ctx context.Context) string {
+	t, _ := ctx.Value(tenantCtxKey{}).(string)
+	return t
+}
+
+// tenantField نام فیلد رزروشده‌ای است که tenant رکورد در سند ذخیره‌شده در آن ثبت می‌شود تا
+// Repair و RotateKeys کلیدهای blind index مدل‌های بدون فیلد محرمانه رمز‌شده را هم بسازند.
+const tenantField = "_tenant"
+
+// recordTenant tenantی را برمی‌گرداند که رکورد m با آن ذخیره شده است: از فیلد tenantField و
+// برای اسناد قدیمی‌تر از اولین ciphertext قالب v3؛ در غیر این صورت "" است.
+func recordTenant(meta *ModelMetadata, m map[string]any) string {
+	if t, ok := m[tenantField].(string); ok {
+		return t
+	}
+	for _, fieldName := range meta.SecretFields {
+		if s, ok := m[meta.JsonNames[fieldName]].(string); ok {
+			if t, ok := ciphertextTenant(s); ok {
+				return t
+			}
+		}
+	}
+	return ""
+}
+
+// storedTenant مانند recordTenant است اما سند JSON ذخیره‌شده را می‌گیرد.
+func storedTenant(meta *ModelMetadata, encJSON string) string {
+	var m map[string]any
+	_ = json.Unmarshal([]byte(encJSON), &m)
+	return recordTenant(meta, m)
+}
+
+// subkeyInfo مقدار info برای HKDF است؛ اجزا با طولشان پیشوند می‌شوند.
+func subkeyInfo(purpose, model, tenant string) string {
+	return string(recordAAD(purpose, model, tenant))
+}
+
+// derive زیرکلید کلید اصلی kid را برای info داده‌شده می‌سازد و نگه می‌دارد.
+func (kr *keyring) derive(kid, info string) []byte {
+	ck := kid + "\x00" + info
+	if k, ok := kr.derived.Load(ck); ok {
+		return k.([]byte)
+	}
+	master := kr.keys[kid]
+	// HKDF فقط برای طول‌های بیش از 255 بلوک خطا می‌دهد.
+	k, _ := hkdf.Key(sha256.New, master, nil, info, len(master))
+	kr.derived.Store(ck, k)
+	return k
+}
+
+// blindIndex مقدار HMAC یک فیلد index_enc را می‌سازد. در حالت WithKeyDerivation از زیرکلید
+// blind index مدل و tenant و در غیر این صورت مستقیماً از کلید اصلی استفاده می‌شود.
+func (c *Client) blindIndex(meta *ModelMetadata, tenant, value string) string {
+	if !c.deriveKeys {
+		return macString(c.kek, value)
+	}
+	return macString(c.ring.derive(c.ring.active, subkeyInfo(subkeyIdx, c.modelName(meta), tenant)), value)
+}
+
+// retiredBlindIndexes مقادیر HMAC دیگری را برمی‌گرداند که value ممکن است پیش از اجرای RotateKeys
+// با آن‌ها ذخیره شده باشد: با هر کلید اصلی keyring، هم بدون زیرکلید (داده‌های پیش از
+// WithKeyDerivation) و هم با زیرکلید blind index مدل و tenant.
+func (c *Client) retiredBlindIndexes(meta *ModelMetadata, tenant, value string) []string {
+	seen := map[string]bool{c.blindIndex(meta, tenant, value): true}
+	var macs []string
+	add := func(mac string) {
+		if !seen[mac] {
+			seen[mac] = true
+			macs = append(macs, mac)
+		}
+	}
+	for _, kid := range c.ring.order {
+		add(macString(c.ring.keys[kid], value))
+		if c.deriveKeys {
+			add(macString(c.ring.derive(kid, subkeyInfo(subkeyIdx, c.modelName(meta), tenant)), value))
+		}
+	}
+	return macs
+}
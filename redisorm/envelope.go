@@ -0,0 +1,223 @@
+package redisorm
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider کلیدهای داده (DEK) را برای رمزنگاری envelope صادر می‌کند. برای هر رکورد یک
+// DEK تازه ساخته می‌شود که با کلید اصلی wrap شده و در کنار ciphertext ذخیره می‌شود.
+type KeyProvider interface {
+	// GenerateDataKey یک کلید داده تازه و نسخه wrap‌شده آن را برمی‌گرداند.
+	GenerateDataKey(ctx context.Context) (plain, wrapped []byte, err error)
+	// DecryptDataKey یک کلید داده wrap‌شده را باز می‌کند.
+	DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// StaleKeyDetector به صورت اختیاری توسط KeyProvider پیاده‌سازی می‌شود تا RotateKeys بتواند
+// کلیدهای داده‌ای را که با کلید اصلی بازنشسته wrap شده‌اند تشخیص دهد.
+type StaleKeyDetector interface {
+	IsStale(wrapped []byte) bool
+}
+
+// WithKeyProvider رمزنگاری envelope را فعال می‌کند؛ فیلدهای محرمانه با کلید داده هر رکورد
+// رمز می‌شوند. HMAC ایندکس‌های رمز‌شده همچنان از کلید اصلی کلاینت استفاده می‌کند.
+func WithKeyProvider(p KeyProvider) Option {
+	return func(c *Client) { c.keyProvider = p }
+}
+
+// WithStrictKeys باعث می‌شود New به جای ساخت یک کلید موقت (که پس از راه‌اندازی مجدد
+// از بین می‌رود) در صورت نبود یا نامعتبر بودن کلید اصلی خطا برگرداند.
+func WithStrictKeys() Option {
+	return func(c *Client) { c.strictKeys = true }
+}
+
+// LocalKeyProvider کلیدهای داده را با یک keyring محلی (کلید فعال و بازنشسته‌ها) wrap می‌کند.
+type LocalKeyProvider struct {
+	ring *keyring
+}
+
+// NewLocalKeyProvider یک KeyProvider محلی با کلید فعال و کلیدهای بازنشسته می‌سازد.
+func NewLocalKeyProvider(active MasterKey, retired ...MasterKey) (*LocalKeyProvider, error) {
+	kr, err := newKeyring(active, retired...)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalKeyProvider{ring: kr}, nil
+}
+
+// LocalKeyProviderFromEnv کلیدها را از یک متغیر محیطی با قالب
+// "id:base64key[,id:base64key...]" می‌خواند؛ اولین کلید، کلید فعال است.
+func LocalKeyProviderFromEnv(name string) (*LocalKeyProvider, error) {
+	spec, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(spec) == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return parseKeySpec(strings.Split(spec, ","))
+}
+
+// LocalKeyProviderFromFile کلیدها را از فایلی می‌خواند که هر خط آن "id:base64key" است؛
+// خطوط خالی و خطوط شروع‌شده با # نادیده گرفته می‌شوند و اولین کلید، کلید فعال است.
+func LocalKeyProviderFromFile(path string) (*LocalKeyProvider, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeySpec(strings.Split(string(bs), "\n"))
+}
+
+// parseKeySpec ورودی‌ها را به کلید تبدیل می‌کند. خطاها فقط شماره ورودی (یا خط فایل) و شناسه کلید
+// را نشان می‌دهند تا خود کلید در لاگ‌ها نیاید.
+func parseKeySpec(entries []string) (*LocalKeyProvider, error) {
+	var keys []MasterKey
+	for i, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" || strings.HasPrefix(e, "#") {
+			continue
+		}
+		id, b64, ok := strings.Cut(e, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry %d (want id:base64key)", i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", id, err)
+		}
+		keys = append(keys, MasterKey{ID: id, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys found")
+	}
+	return NewLocalKeyProvider(keys[0], keys[1:]...)
+}
+
+func (p *LocalKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	dek, err := randBytes(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := p.ring.seal(dek, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dek, []byte(wrapped), nil
+}
+
+func (p *LocalKeyProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	return p.ring.open(string(wrapped), nil, "")
+}
+
+func (p *LocalKeyProvider) IsStale(wrapped []byte) bool { return !p.ring.isCurrent(string(wrapped)) }
+
+// KMS حداقل قابلیت‌های لازم از یک سرویس مدیریت کلید (AWS KMS، GCP KMS، Vault Transit و ...)
+// است. برای اتصال به یک KMS واقعی کافی است این دو متد را پیاده‌سازی کنید.
+type KMS interface {
+	Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// kmsKeyProvider کلیدهای داده را با یک KMS خارجی wrap می‌کند. شناسه کلید KMS در
+// ابتدای مقدار wrap‌شده ذخیره می‌شود تا پس از تغییر کلید فعال هم قابل بازکردن باشد.
+type kmsKeyProvider struct {
+	kms   KMS
+	keyID string
+}
+
+// NewKMSKeyProvider یک KeyProvider می‌سازد که کلیدهای داده را با کلید keyID در KMS wrap می‌کند.
+func NewKMSKeyProvider(kms KMS, keyID string) KeyProvider {
+	return &kmsKeyProvider{kms: kms, keyID: keyID}
+}
+
+func (p *kmsKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	dek, err := randBytes(32)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, err := p.kms.Encrypt(ctx, p.keyID, dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped := binary.AppendUvarint(nil, uint64(len(p.keyID)))
+	wrapped = append(wrapped, p.keyID...)
+	return dek, append(wrapped, ct...), nil
+}
+
+func (p *kmsKeyProvider) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	keyID, ct, err := splitWrappedKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return p.kms.Decrypt(ctx, keyID, ct)
+}
+
+func (p *kmsKeyProvider) IsStale(wrapped []byte) bool {
+	keyID, _, err := splitWrappedKey(wrapped)
+	return err != nil || keyID != p.keyID
+}
+
+func splitWrappedKey(wrapped []byte) (string, []byte, error) {
+	n, sz := binary.Uvarint(wrapped)
+	if sz <= 0 || uint64(len(wrapped)-sz) < n {
+		return "", nil, errors.New("invalid wrapped data key")
+	}
+	rest := wrapped[sz:]
+	return string(rest[:n]), rest[n:], nil
+}
+
+// MemoryKMS یک KMS درون‌حافظه‌ای برای تست و توسعه محلی است.
+type MemoryKMS struct {
+	keys map[string][]byte
+}
+
+// NewMemoryKMS یک KMS درون‌حافظه‌ای با کلیدهای داده‌شده (بر اساس شناسه) می‌سازد.
+func NewMemoryKMS(keys map[string][]byte) (*MemoryKMS, error) {
+	for id, k := range keys {
+		if !validKeyLen(k) {
+			return nil, fmt.Errorf("kms key %q must be 16, 24 or 32 bytes", id)
+		}
+	}
+	return &MemoryKMS{keys: keys}, nil
+}
+
+func (m *MemoryKMS) Encrypt(ctx context.Context, keyID string, plaintext []byte) ([]byte, error) {
+	gcm, err := m.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, []byte(keyID)), nil
+}
+
+func (m *MemoryKMS) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	gcm, err := m.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	ns := gcm.NonceSize()
+	if len(ciphertext) < ns {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, ciphertext[:ns], ciphertext[ns:], []byte(keyID))
+}
+
+func (m *MemoryKMS) aead(keyID string) (cipher.AEAD, error) {
+	key, ok := m.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown kms key %q", keyID)
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(bc)
+}
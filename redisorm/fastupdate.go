@@ -0,0 +1,105 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// UpdateOption گزینه‌های UpdateFieldsFast است.
+type UpdateOption func(*updateOptions)
+
+type updateOptions struct {
+	expectVersion *int64
+}
+
+// ExpectVersion به‌روزرسانی را فقط در صورتی انجام می‌دهد که نسخه فعلی رکورد (کلید ver) برابر v
+// باشد؛ در غیر این صورت ErrVersionConflict برگردانده می‌شود.
+func ExpectVersion(v int64) UpdateOption {
+	return func(o *updateOptions) { o.expectVersion = &v }
+}
+
+// fastUpdatePlan کلیدهای ایندکسی است که اسکریپت UpdateFieldsFast باید تغییر دهد.
+type fastUpdatePlan struct {
+	keys []string
+	argv []interface{} // تعداد slotها و کلیدهای range، تنظیمات CDC، تاریخچه و audit، مشخصات slotها و امتیازهای range
+	uniq []string      // کلیدهای یکتای جدید که مالک فعلی آن‌ها باید پیش از اجرا خوانده شود
+}
+
+// planFastUpdate کلیدهای جدید slotهای ایندکسی و بازه‌ای را فقط برای فیلدهایی که به‌روزرسانی
+// آن‌ها را لمس می‌کند، از روی خود مقادیر جدید می‌سازد. کلیدهای قبلی از shadow رکورد خوانده
+// می‌شوند، بنابراین سند فعلی خوانده نمی‌شود.
+func (c *Client) planFastUpdate(ctx context.Context, meta *ModelMetadata, sample any, modelPrefix, id string, updates, auto map[string]any) (*fastUpdatePlan, error) {
+	touches := func(fieldName string) bool {
+		top := meta.JsonPaths[fieldName][0]
+		_, inUpdates := updates[top]
+		_, inAuto := auto[top]
+		return inUpdates || inAuto
+	}
+	var names []string
+	for _, name := range slotNames(meta) {
+		_, fieldName, _ := strings.Cut(name, ":")
+		if touches(fieldName) {
+			names = append(names, name)
+		}
+	}
+	var touchedRange []string
+	for _, fieldName := range meta.RangeFields {
+		if touches(fieldName) {
+			touchedRange = append(touchedRange, fieldName)
+		}
+	}
+	if len(names) == 0 && len(touchedRange) == 0 {
+		argv := append([]interface{}{0, 0, 0}, c.changeArgs(meta, modelPrefix, id)...)
+		argv = append(argv, meta.HistorySize)
+		return &fastUpdatePlan{argv: append(argv, c.auditArgs(ctx, meta)...)}, nil
+	}
+
+	m := map[string]any{}
+	for k, v := range auto {
+		m[k] = v
+	}
+	for k, v := range updates {
+		m[k] = v
+	}
+	plain, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	slots := c.indexSlots(meta, modelPrefix, TenantFrom(ctx), plain)
+	slotKeys, slotSpecs := slotArgs(names, slots)
+	guardKeys, guardSpecs := c.uniqueGuards(meta, modelPrefix, TenantFrom(ctx), plain, names)
+	slotKeys, slotSpecs = append(slotKeys, guardKeys...), append(slotSpecs, guardSpecs...)
+
+	var addRange, remRange []string
+	var rangeScores []interface{}
+	if len(touchedRange) > 0 {
+		rt := reflect.TypeOf(sample)
+		for rt.Kind() == reflect.Pointer {
+			rt = rt.Elem()
+		}
+		obj := reflect.New(rt).Interface()
+		if err := json.Unmarshal(plain, obj); err != nil {
+			return nil, err
+		}
+		scores := extractRange(obj, meta)
+		for _, fieldName := range touchedRange {
+			if score, ok := scores[fieldName]; ok {
+				addRange = append(addRange, c.keyRange(modelPrefix, fieldName))
+				rangeScores = append(rangeScores, formatScore(score))
+			} else {
+				remRange = append(remRange, c.keyRange(modelPrefix, fieldName))
+			}
+		}
+	}
+
+	plan := &fastUpdatePlan{argv: []interface{}{len(slotSpecs), len(addRange), len(remRange)}, uniq: append(uniqKeys(names, slots), guardKeys...)}
+	plan.argv = append(plan.argv, c.changeArgs(meta, modelPrefix, id)...)
+	plan.argv = append(plan.argv, meta.HistorySize)
+	plan.argv = append(plan.argv, c.auditArgs(ctx, meta)...)
+	plan.keys = append(append(slotKeys, addRange...), remRange...)
+	plan.argv = append(plan.argv, slotSpecs...)
+	plan.argv = append(plan.argv, rangeScores...)
+	return plan, nil
+}
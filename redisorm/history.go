@@ -0,0 +1,120 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrVersionNotFound زمانی برگردانده می‌شود که نسخه خواسته‌شده در تاریخچه رکورد نباشد.
+var ErrVersionNotFound = errors.New("version not found in history")
+
+// versionPlaceholder در فیلد نسخه Saveهای غیرخوش‌بینانه مدل‌های دارای تاریخچه قرار می‌گیرد و
+// luaSave آن را با مقدار جدید کلید نسخه جایگزین می‌کند.
+const versionPlaceholder = "\x00redisorm:version\x00"
+
+// HistoryEntry یک نسخه ذخیره‌شده در تاریخچه رکورد است.
+type HistoryEntry struct {
+	Version int64     // مقدار کلید نسخه پس از نوشتن
+	At      time.Time // زمان نوشتن (از شناسه ورودی stream)
+}
+
+func (c *Client) keyHistory(modelPrefix, id string) string {
+	return fmt.Sprintf("%s:hist:%s:%s", c.ns, modelPrefix, id)
+}
+
+// historyRecord مدل و شناسه رکورد را برای توابع تاریخچه تعیین می‌کند.
+func (c *Client) historyRecord(sample, id any) (*ModelMetadata, string, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return nil, "", err
+	}
+	if meta.HistorySize == 0 {
+		return nil, "", fmt.Errorf("%s does not keep history; add the history=N redis tag option", meta.StructName)
+	}
+	key, err := recordID(meta, sample, id)
+	if err != nil {
+		return nil, "", err
+	}
+	if key == "" {
+		return nil, "", errors.New("empty pk for history")
+	}
+	return meta, key, nil
+}
+
+// History نسخه‌های نگه‌داشته‌شده یک رکورد را از جدیدترین به قدیمی‌ترین برمی‌گرداند؛ id مانند Load
+// تعیین می‌شود.
+func (c *Client) History(ctx context.Context, sample any, id any) ([]HistoryEntry, error) {
+	meta, key, err := c.historyRecord(sample, id)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := c.rdb.XRevRange(ctx, c.keyHistory(c.modelPrefix(meta), key), "+", "-").Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]HistoryEntry, 0, len(msgs))
+	for _, msg := range msgs {
+		s, _ := msg.Values["version"].(string)
+		version, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("history entry %s: bad version: %w", msg.ID, err)
+		}
+		ms, _ := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64)
+		out = append(out, HistoryEntry{Version: version, At: time.UnixMilli(ms)})
+	}
+	return out, nil
+}
+
+// LoadVersion نسخه version رکورد را از تاریخچه خوانده و پس از رمزگشایی فیلدهای secret در dst قرار
+// می‌دهد. اگر آن نسخه نگه‌داشته نشده باشد ErrVersionNotFound برگردانده می‌شود.
+func (c *Client) LoadVersion(ctx context.Context, dst any, id any, version int64) error {
+	if dst == nil {
+		return errors.New("nil dst")
+	}
+	meta, key, err := c.historyRecord(dst, id)
+	if err != nil {
+		return err
+	}
+	msgs, err := c.rdb.XRevRange(ctx, c.keyHistory(c.modelPrefix(meta), key), "+", "-").Result()
+	if err != nil {
+		return err
+	}
+	want := strconv.FormatInt(version, 10)
+	for _, msg := range msgs {
+		if v, _ := msg.Values["version"].(string); v != want {
+			continue
+		}
+		doc, _ := msg.Values["doc"].(string)
+		plain, err := c.decryptForType(ctx, meta, key, doc)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(plain, dst)
+	}
+	return ErrVersionNotFound
+}
+
+// Revert رکورد را به نسخه version برمی‌گرداند. نسخه قدیمی با مسیر عادی Save دوباره ذخیره می‌شود؛
+// بنابراین ایندکس‌ها به‌روز می‌شوند و خود بازگردانی نسخه جدیدی در تاریخچه است.
+func (c *Client) Revert(ctx context.Context, sample any, id any, version int64) error {
+	meta, key, err := c.historyRecord(sample, id)
+	if err != nil {
+		return err
+	}
+	rt := reflect.TypeOf(sample)
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	v := reflect.New(rt).Interface()
+	if err := c.LoadVersion(ctx, v, key, version); err != nil {
+		return err
+	}
+	_, err = c.save(ctx, meta, v)
+	return err
+}
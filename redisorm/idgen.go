@@ -0,0 +1,212 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IDGenerator یک اینترفیس برای مدل‌هایی است که می‌خواهند کلید اصلی خالی را خودشان تولید کنند.
+// مقدار برگشتی برای کلیدهای عددی باید یک عدد صحیح معتبر باشد.
+type IDGenerator interface {
+	NewID(ctx context.Context) (string, error)
+}
+
+// راهبردهای تولید شناسه در تگ default.
+const (
+	idULID      = "ulid"      // ULID مرتب‌شونده بر اساس زمان (فقط string)
+	idSnowflake = "snowflake" // شناسه 64 بیتی Snowflake (عدد صحیح یا string)
+	idSeq       = "seq"       // INCR روی کلید ترتیب مدل (عدد صحیح یا string)
+)
+
+func isIDStrategy(tag string) bool {
+	return tag == idULID || tag == idSnowflake || tag == idSeq
+}
+
+// WithSnowflakeNode شماره گره (0 تا 1023) را برای شناسه‌های Snowflake تنظیم می‌کند. هر نمونه
+// سرویس که همزمان شناسه می‌سازد باید شماره گره متفاوتی داشته باشد.
+func WithSnowflakeNode(node int64) Option {
+	return func(c *Client) { c.snowflake.node = node & snowflakeNodeMask }
+}
+
+func (c *Client) keySeq(modelPrefix string) string {
+	return fmt.Sprintf("%s:seq:%s", c.ns, modelPrefix)
+}
+
+// generateIDs کلید اصلی خالی مدل‌های IDGenerator و فیلدهای خالی دارای default:"ulid"،
+// default:"snowflake" یا default:"seq" را پر می‌کند. بزرگ‌ترین مقدار عددی دستی فیلدهای seq
+// برگردانده می‌شود (صفر یعنی هیچ)؛ luaSave ترتیب مدل را تا آن مقدار بالا می‌برد تا شناسه‌های بعدی
+// رکورد دستی را بازنویسی نکنند، بدون رفت‌وبرگشت جداگانه.
+func (c *Client) generateIDs(ctx context.Context, v any, meta *ModelMetadata) (uint64, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return 0, nil
+	}
+	rv = rv.Elem()
+
+	if g, ok := v.(IDGenerator); ok && len(meta.PKFields) == 1 {
+		fv := rv.FieldByName(meta.PKFields[0])
+		if fv.CanSet() && isZero(fv) {
+			id, err := g.NewID(ctx)
+			if err != nil {
+				return 0, fmt.Errorf("generate id: %w", err)
+			}
+			if err := setGeneratedID(fv, id); err != nil {
+				return 0, fmt.Errorf("generate id: %w", err)
+			}
+		}
+	}
+
+	var seqFloor uint64
+	for fieldName, strategy := range meta.DefaultFields {
+		if !isIDStrategy(strategy) {
+			continue
+		}
+		fv := rv.FieldByName(fieldName)
+		if !fv.CanSet() {
+			continue
+		}
+		if !isZero(fv) {
+			// مقادیر غیر عددی ترتیب را تغییر نمی‌دهند.
+			if strategy == idSeq {
+				if n, err := strconv.ParseUint(fmt.Sprint(fv.Interface()), 10, 63); err == nil {
+					seqFloor = max(seqFloor, n)
+				}
+			}
+			continue
+		}
+		var id string
+		switch strategy {
+		case idULID:
+			ulid, err := c.ulid.next()
+			if err != nil {
+				return 0, fmt.Errorf("generate ulid for %s: %w", fieldName, err)
+			}
+			id = ulid
+		case idSnowflake:
+			id = strconv.FormatInt(c.snowflake.next(), 10)
+		case idSeq:
+			n, err := c.rdb.Incr(ctx, c.keySeq(c.modelPrefix(meta))).Result()
+			if err != nil {
+				return 0, fmt.Errorf("next sequence for %s: %w", fieldName, err)
+			}
+			id = strconv.FormatInt(n, 10)
+		}
+		if err := setGeneratedID(fv, id); err != nil {
+			return 0, fmt.Errorf("%s (default:%q): %w", fieldName, strategy, err)
+		}
+	}
+	return seqFloor, nil
+}
+
+// setGeneratedID شناسه تولیدشده را در فیلد رشته‌ای یا عددی قرار می‌دهد.
+func setGeneratedID(fv reflect.Value, id string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(id)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(id, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("id %q does not fit %s", id, fv.Type())
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(id, 10, fv.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("id %q does not fit %s", id, fv.Type())
+		}
+		fv.SetUint(n)
+	default:
+		return fmt.Errorf("cannot store generated id in %s", fv.Type())
+	}
+	return nil
+}
+
+// ulidAlphabet الفبای Base32 کراکفورد است.
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ulidGen شناسه‌های ULID یکنوا می‌سازد: در یک میلی‌ثانیه، بخش تصادفی شناسه قبلی یکی
+// افزایش می‌یابد تا ترتیب شناسه‌ها با ترتیب تولید یکی باشد.
+type ulidGen struct {
+	mu     sync.Mutex
+	lastMS uint64
+	randHi uint16
+	randLo uint64
+}
+
+func (g *ulidGen) next() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := uint64(time.Now().UnixMilli())
+	if ms <= g.lastMS {
+		ms = g.lastMS
+		g.randLo++
+		if g.randLo == 0 {
+			g.randHi++
+		}
+	} else {
+		b, err := randBytes(10)
+		if err != nil {
+			return "", err
+		}
+		g.lastMS = ms
+		g.randHi = binary.BigEndian.Uint16(b[:2])
+		g.randLo = binary.BigEndian.Uint64(b[2:])
+	}
+
+	// 48 بیت زمان و 80 بیت تصادفی در 26 نویسه 5 بیتی (دو بیت بالایی صفر است).
+	hi, lo := ms<<16|uint64(g.randHi), g.randLo
+	var out [26]byte
+	for i := len(out) - 1; i >= 0; i-- {
+		out[i] = ulidAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
+
+// ساختار شناسه Snowflake: 41 بیت میلی‌ثانیه از snowflakeEpoch، 10 بیت گره و 12 بیت ترتیب.
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeNodeMask = 1<<snowflakeNodeBits - 1
+	snowflakeSeqMask  = 1<<snowflakeSeqBits - 1
+)
+
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+type snowflakeGen struct {
+	mu     sync.Mutex
+	node   int64
+	lastMS int64
+	seq    int64
+}
+
+func (g *snowflakeGen) next() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := time.Now().UnixMilli()
+	if ms < g.lastMS {
+		// ساعت به عقب برگشته است؛ برای حفظ ترتیب از آخرین زمان ادامه می‌دهیم.
+		ms = g.lastMS
+	}
+	if ms == g.lastMS {
+		g.seq = (g.seq + 1) & snowflakeSeqMask
+		if g.seq == 0 {
+			for ms <= g.lastMS {
+				time.Sleep(100 * time.Microsecond)
+				ms = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+	g.lastMS = ms
+	return (ms-snowflakeEpoch)<<(snowflakeNodeBits+snowflakeSeqBits) | g.node<<snowflakeSeqBits | g.seq
+}
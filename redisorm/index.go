@@ -3,6 +3,8 @@ package redisorm
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"time"
 )
 
 func extractIndexable(v any, plain []byte, meta *ModelMetadata) map[string]string {
@@ -15,27 +17,35 @@ func extractIndexable(v any, plain []byte, meta *ModelMetadata) map[string]strin
 	_ = json.Unmarshal(plain, &m)
 
 	for _, fieldName := range meta.IndexedFields {
-		jsonName := meta.JsonNames[fieldName]
-		if v, ok := m[jsonName]; ok {
+		if v, ok := docValue(m, meta, fieldName); ok {
 			idx[fieldName] = fmt.Sprint(v)
 		}
 	}
 	return idx
 }
 
-func extractEncIndex(c *Client, v any, plain []byte, meta *ModelMetadata) map[string]string {
+// extractEncIndex مقادیر HMAC فیلدهای index_enc را با زیرکلید blind index tenant برمی‌گرداند.
+func extractEncIndex(c *Client, tenant string, plain []byte, meta *ModelMetadata) map[string]string {
+	return extractBlind(c, tenant, plain, meta, meta.EncIndexedFields)
+}
+
+// extractEncUnique مقادیر HMAC فیلدهای unique_enc را برمی‌گرداند.
+func extractEncUnique(c *Client, tenant string, plain []byte, meta *ModelMetadata) map[string]string {
+	return extractBlind(c, tenant, plain, meta, meta.EncUniqueFields)
+}
+
+func extractBlind(c *Client, tenant string, plain []byte, meta *ModelMetadata, fields []string) map[string]string {
 	encIdx := map[string]string{}
-	if len(meta.EncIndexedFields) == 0 {
+	if len(fields) == 0 {
 		return encIdx
 	}
 
 	var m map[string]any
 	_ = json.Unmarshal(plain, &m)
 
-	for _, fieldName := range meta.EncIndexedFields {
-		jsonName := meta.JsonNames[fieldName]
-		if v, ok := m[jsonName]; ok {
-			encIdx[fieldName] = macString(c.kek, fmt.Sprint(v))
+	for _, fieldName := range fields {
+		if v, ok := docValue(m, meta, fieldName); ok {
+			encIdx[fieldName] = c.blindIndex(meta, tenant, fmt.Sprint(v))
 		}
 	}
 	return encIdx
@@ -51,60 +61,55 @@ func extractUnique(v any, plain []byte, meta *ModelMetadata) map[string]string {
 	_ = json.Unmarshal(plain, &m)
 
 	for _, fieldName := range meta.UniqueFields {
-		jsonName := meta.JsonNames[fieldName]
-		if v, ok := m[jsonName]; ok {
+		if v, ok := docValue(m, meta, fieldName); ok {
 			uniq[fieldName] = fmt.Sprint(v)
 		}
 	}
 	return uniq
 }
 
-func diffUniqueKeys(c *Client, modelPrefix string, cur, prev map[string]string) (add, del []string) {
-	for f, v := range cur {
-		if prev == nil || prev[f] != v {
-			add = append(add, c.keyUniq(modelPrefix, f, v))
-		}
+// extractRange امتیاز عددی فیلدهای range را مستقیماً از struct استخراج می‌کند.
+// فیلدهایی که مقدار ندارند (مثلاً اشاره‌گر nil) در خروجی نمی‌آیند.
+func extractRange(v any, meta *ModelMetadata) map[string]float64 {
+	scores := map[string]float64{}
+	if len(meta.RangeFields) == 0 {
+		return scores
 	}
-	for f, v := range prev {
-		if cur == nil || cur[f] != v {
-			del = append(del, c.keyUniq(modelPrefix, f, v))
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return scores
 		}
+		rv = rv.Elem()
 	}
-	return
-}
-
-func diffIndexKeys(c *Client, modelPrefix string, cur, prev map[string]string) (add, rem []string) {
-	for f, v := range cur {
-		if prev == nil || prev[f] != v {
-			add = append(add, c.keyIdx(modelPrefix, f, v))
-		}
-	}
-	for f, v := range prev {
-		if cur == nil || cur[f] != v {
-			rem = append(rem, c.keyIdx(modelPrefix, f, v))
+	for _, fieldName := range meta.RangeFields {
+		if score, ok := rangeScore(fieldByPath(rv, fieldName)); ok {
+			scores[fieldName] = score
 		}
 	}
-	return
+	return scores
 }
 
-func diffEncIndexKeys(c *Client, modelPrefix string, cur, prev map[string]string) (add, rem []string) {
-	for f, v := range cur {
-		if prev == nil || prev[f] != v {
-			add = append(add, c.keyIdxEnc(modelPrefix, f, v))
+// rangeScore مقدار یک فیلد عددی یا time.Time را به امتیاز ZSET تبدیل می‌کند.
+// زمان‌ها به صورت میلی‌ثانیه یونیکس ذخیره می‌شوند.
+func rangeScore(fv reflect.Value) (float64, bool) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			return 0, false
 		}
+		fv = fv.Elem()
 	}
-	for f, v := range prev {
-		if cur == nil || cur[f] != v {
-			rem = append(rem, c.keyIdxEnc(modelPrefix, f, v))
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(fv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), true
+	case reflect.Struct:
+		if t, ok := fv.Interface().(time.Time); ok {
+			return float64(t.UnixMilli()), true
 		}
 	}
-	return
+	return 0, false
 }
-
-func keysFromMap(c *Client, modelPrefix string, mp map[string]string, f func(prefix, field, val string) string) []string {
-	out := make([]string, 0, len(mp))
-	for k, v := range mp {
-		out = append(out, f(modelPrefix, k, v))
-	}
-	return out
-}
\ No newline at end of file
@@ -0,0 +1,258 @@
+package redisorm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expiredChannel الگوی کانال رویداد انقضای کلیدها در همه پایگاه‌داده‌ها است.
+const expiredChannel = "__keyevent@*__:expired"
+
+// Janitor ورودی‌های ایندکس، یکتا، بازه‌ای، نسخه و تاریخچه رکوردهایی را که با TTL منقضی شده‌اند پاک می‌کند.
+// رویدادهای انقضا از keyspace notifications دریافت می‌شوند (سرور باید با
+// notify-keyspace-events شامل "Ex" پیکربندی شده باشد) و یک پیمایش دوره‌ای رویدادهای ازدست‌رفته
+// را جبران می‌کند. پاک‌سازی از روی shadow رکورد انجام می‌شود و به سند منقضی‌شده نیازی ندارد.
+type Janitor struct {
+	c        *Client
+	models   map[string]*ModelMetadata // بر اساس پیشوند مدل
+	interval time.Duration
+	onError  func(error)
+}
+
+// JanitorOption گزینه‌های NewJanitor است.
+type JanitorOption func(*Janitor)
+
+// WithSweepInterval فاصله پیمایش دوره‌ای را تعیین می‌کند (پیش‌فرض 10 دقیقه). مقدار صفر یا
+// منفی پیمایش دوره‌ای را غیرفعال می‌کند.
+func WithSweepInterval(d time.Duration) JanitorOption {
+	return func(j *Janitor) { j.interval = d }
+}
+
+// WithJanitorErrorHandler خطاهای پاک‌سازی در Run را گزارش می‌کند؛ Run با این خطاها متوقف نمی‌شود.
+func WithJanitorErrorHandler(fn func(error)) JanitorOption {
+	return func(j *Janitor) { j.onError = fn }
+}
+
+// NewJanitor یک Janitor برای مدل‌های داده‌شده می‌سازد.
+func (c *Client) NewJanitor(models []any, opts ...JanitorOption) (*Janitor, error) {
+	if len(models) == 0 {
+		return nil, errors.New("no models for janitor")
+	}
+	j := &Janitor{c: c, models: map[string]*ModelMetadata{}, interval: 10 * time.Minute}
+	for _, m := range models {
+		meta, err := c.getModelMetadata(m)
+		if err != nil {
+			return nil, err
+		}
+		j.models[c.modelPrefix(meta)] = meta
+	}
+	for _, o := range opts {
+		o(j)
+	}
+	return j, nil
+}
+
+// Run رویدادهای انقضا را دنبال و به صورت دوره‌ای پیمایش می‌کند تا ctx لغو شود. در کلاستر و
+// Ring روی همه nodeها مشترک می‌شود؛ اتصال‌های قطع‌شده را go-redis دوباره برقرار می‌کند.
+func (j *Janitor) Run(ctx context.Context) error {
+	var nodes []redis.UniversalClient
+	var mu sync.Mutex
+	collect := func(ctx context.Context, node *redis.Client) error {
+		mu.Lock()
+		nodes = append(nodes, node)
+		mu.Unlock()
+		return nil
+	}
+	switch rdb := j.c.rdb.(type) {
+	case *redis.ClusterClient:
+		if err := rdb.ForEachMaster(ctx, collect); err != nil {
+			return err
+		}
+	case *redis.Ring:
+		if err := rdb.ForEachShard(ctx, collect); err != nil {
+			return err
+		}
+	default:
+		nodes = []redis.UniversalClient{j.c.rdb}
+	}
+
+	events := make(chan string, 256)
+	for _, node := range nodes {
+		ps := node.PSubscribe(ctx, expiredChannel)
+		if _, err := ps.Receive(ctx); err != nil {
+			_ = ps.Close()
+			return err
+		}
+		defer ps.Close()
+		go func(ch <-chan *redis.Message) {
+			for msg := range ch {
+				select {
+				case events <- msg.Payload:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(ps.Channel())
+	}
+
+	var tick <-chan time.Time
+	if j.interval > 0 {
+		t := time.NewTicker(j.interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case key := <-events:
+			if meta, id, ok := j.match(key); ok {
+				if _, err := j.c.reap(ctx, meta, []string{id}); err != nil {
+					j.report(err)
+				}
+			}
+		case <-tick:
+			if _, err := j.Sweep(ctx); err != nil {
+				j.report(err)
+			}
+		}
+	}
+}
+
+func (j *Janitor) report(err error) {
+	if j.onError != nil && !errors.Is(err, context.Canceled) {
+		j.onError(err)
+	}
+}
+
+// match مدل و شناسه کلید val منقضی‌شده را پیدا می‌کند.
+func (j *Janitor) match(key string) (*ModelMetadata, string, bool) {
+	rest, ok := strings.CutPrefix(key, j.c.ns+":val:")
+	if !ok {
+		return nil, "", false
+	}
+	for prefix, meta := range j.models {
+		if id, ok := strings.CutPrefix(rest, prefix+":"); ok && id != "" {
+			return meta, id, true
+		}
+	}
+	return nil, "", false
+}
+
+// Sweep یک بار shadowها، کلیدهای نسخه و ایندکس‌های بازه‌ای مدل‌ها را پیمایش می‌کند و آثار
+// رکوردهایی را که دیگر وجود ندارند پاک می‌کند. تعداد رکوردهای پاک‌سازی‌شده برگردانده می‌شود.
+func (j *Janitor) Sweep(ctx context.Context) (int, error) {
+	total := 0
+	for _, meta := range j.models {
+		n, err := j.c.sweepModel(ctx, meta)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (c *Client) sweepModel(ctx context.Context, meta *ModelMetadata) (int, error) {
+	modelPrefix := c.modelPrefix(meta)
+	total := 0
+	for _, kind := range []string{"shd", "ver"} {
+		prefix := c.ns + ":" + kind + ":" + modelPrefix + ":"
+		err := c.scanKeys(ctx, c.keyPattern(kind, modelPrefix), func(keys []string) error {
+			ids := make([]string, len(keys))
+			for i, k := range keys {
+				ids[i] = strings.TrimPrefix(k, prefix)
+			}
+			n, err := c.reap(ctx, meta, ids)
+			total += n
+			return err
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+	for _, fieldName := range meta.RangeFields {
+		key := c.keyRange(modelPrefix, fieldName)
+		var cursor uint64
+		for {
+			members, next, err := c.rdb.ZScan(ctx, key, cursor, "", scanBatch).Result()
+			if err != nil {
+				return total, err
+			}
+			ids := make([]string, 0, len(members)/2)
+			for i := 0; i < len(members); i += 2 {
+				ids = append(ids, members[i])
+			}
+			n, err := c.reap(ctx, meta, ids)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return total, nil
+}
+
+// reap آثار شناسه‌هایی را که کلید val آن‌ها وجود ندارد پاک می‌کند. بررسی دوباره وجود رکورد داخل
+// اسکریپت انجام می‌شود، پس رکوردی که همزمان دوباره ساخته شود دست نمی‌خورد.
+func (c *Client) reap(ctx context.Context, meta *ModelMetadata, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	modelPrefix := c.modelPrefix(meta)
+	pipe := c.rdb.Pipeline()
+	exists := make([]*redis.IntCmd, len(ids))
+	current := make([]func() []string, len(ids))
+	for i, id := range ids {
+		exists[i] = pipe.Exists(ctx, c.keyVal(modelPrefix, id))
+		current[i] = c.queueCurrentKeys(ctx, pipe, modelPrefix, id, nil)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	// Run داخل pipeline در صورت NOSCRIPT به EVAL برنمی‌گردد، پس اسکریپت از قبل بارگذاری می‌شود.
+	if err := c.luaReap.Load(ctx, c.rdb).Err(); err != nil {
+		return 0, err
+	}
+	pipe = c.rdb.Pipeline()
+	var cmds []*redis.Cmd
+	for i, id := range ids {
+		if exists[i].Val() == 1 {
+			continue
+		}
+		keys := []string{c.keyVer(modelPrefix, id), c.keyVal(modelPrefix, id), c.keyShadow(modelPrefix, id), c.keyHistory(modelPrefix, id)}
+		for _, fieldName := range meta.RangeFields {
+			keys = append(keys, c.keyRange(modelPrefix, fieldName))
+		}
+		keys = append(keys, current[i]()...)
+		cmds = append(cmds, c.luaReap.Run(ctx, pipe, keys, id, len(meta.RangeFields)))
+	}
+	if len(cmds) == 0 {
+		return 0, nil
+	}
+	// رکوردی که shadow آن همزمان تغییر کرده (STALE_KEYS) در گذر بعدی پاک‌سازی می‌شود.
+	var rerr redis.Error
+	if _, err := pipe.Exec(ctx); err != nil && !errors.As(err, &rerr) {
+		return 0, err
+	}
+	n := 0
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && !isStaleKeys(err) {
+			return n, err
+		}
+		if v, _ := cmd.Int(); v == 1 {
+			n++
+		}
+	}
+	return n, nil
+}
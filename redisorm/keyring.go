@@ -0,0 +1,276 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultKeyID شناسه کلیدی است که WithMasterKey به کلید اصلی نسبت می‌دهد.
+const defaultKeyID = "default"
+
+// MasterKey یک کلید اصلی (KEK) به همراه شناسه آن است. شناسه در هر ciphertext درج می‌شود
+// تا پس از چرخش کلید، داده‌های قدیمی همچنان با کلید بازنشسته خوانده شوند.
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+// WithKeyring کلید فعال و کلیدهای بازنشسته را تنظیم می‌کند. داده‌های جدید همیشه با کلید
+// فعال رمز می‌شوند و کلیدهای بازنشسته فقط برای رمزگشایی استفاده می‌شوند.
+func WithKeyring(active MasterKey, retired ...MasterKey) Option {
+	return func(c *Client) {
+		c.kek = active.Key
+		c.kid = active.ID
+		c.keyring = true
+		c.retired = retired
+	}
+}
+
+// keyring مجموعه کلیدهای اصلی به همراه کلید فعال است.
+type keyring struct {
+	active  string
+	keys    map[string][]byte
+	order   []string
+	derived sync.Map // kid + info -> زیرکلید HKDF
+}
+
+// newKeyring کلید فعال و بازنشسته‌ها را اعتبارسنجی کرده و یک keyring می‌سازد.
+func newKeyring(active MasterKey, retired ...MasterKey) (*keyring, error) {
+	kr := &keyring{active: active.ID, keys: make(map[string][]byte, 1+len(retired))}
+	for _, k := range append([]MasterKey{active}, retired...) {
+		if k.ID == "" || strings.Contains(k.ID, ":") {
+			return nil, fmt.Errorf("invalid master key id %q", k.ID)
+		}
+		if !validKeyLen(k.Key) {
+			return nil, fmt.Errorf("master key %q must be 16, 24 or 32 bytes", k.ID)
+		}
+		if _, dup := kr.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate master key id %q", k.ID)
+		}
+		kr.keys[k.ID] = k.Key
+		kr.order = append(kr.order, k.ID)
+	}
+	return kr, nil
+}
+
+func validKeyLen(k []byte) bool {
+	l := len(k)
+	return l == 16 || l == 24 || l == 32
+}
+
+// seal مقدار را با کلید فعال رمز می‌کند. بدون aad قالب v1 (برای wrap کلیدهای داده) و با aad
+// قالب v2 تولید می‌شود.
+func (kr *keyring) seal(plain, aad []byte) (string, error) {
+	prefix := fieldEncPrefix
+	if aad != nil {
+		prefix = fieldEncPrefixV2
+	}
+	return aesGCMSeal(prefix, kr.active, kr.keys[kr.active], plain, aad)
+}
+
+// sealDerived مقدار را با زیرکلید رمزنگاری (HKDF) مدل model و tenant در قالب v3 رمز می‌کند.
+// tenant پس از شناسه کلید در ciphertext درج می‌شود تا رمزگشایی به context خواننده وابسته نباشد.
+func (kr *keyring) sealDerived(plain, aad []byte, model, tenant string) (string, error) {
+	key := kr.derive(kr.active, subkeyInfo(subkeyEnc, model, tenant))
+	kid := kr.active + ":" + base64.RawURLEncoding.EncodeToString([]byte(tenant))
+	return aesGCMSeal(fieldEncPrefixV3, kid, key, plain, aad)
+}
+
+// splitTenant tenant درج‌شده و بدنه base64 را از بدنه یک ciphertext قالب v3 جدا می‌کند.
+func splitTenant(body string) (tenant, payload string, err error) {
+	stamp, payload, ok := strings.Cut(body, ":")
+	if !ok {
+		return "", "", errors.New("missing tenant")
+	}
+	t, err := base64.RawURLEncoding.DecodeString(stamp)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid tenant: %w", err)
+	}
+	return string(t), payload, nil
+}
+
+// ciphertextTenant tenant درج‌شده در یک ciphertext قالب v3 را برمی‌گرداند.
+func ciphertextTenant(enc string) (string, bool) {
+	_, body, ver, err := splitKeyID(enc)
+	if err != nil || ver != 3 {
+		return "", false
+	}
+	tenant, _, err := splitTenant(body)
+	return tenant, err == nil
+}
+
+// open مقدار رمز‌شده را با کلیدی که شناسه آن در ciphertext آمده باز می‌کند.
+// برای مقادیر قدیمی بدون شناسه، همه کلیدها به ترتیب امتحان می‌شوند.
+// aad برای قالب‌های v2 و v3 و model فقط برای انتخاب زیرکلید v3 استفاده می‌شود.
+func (kr *keyring) open(enc string, aad []byte, model string) ([]byte, error) {
+	kid, body, ver, err := splitKeyID(enc)
+	if err != nil {
+		return nil, err
+	}
+	if ver == 1 {
+		aad = nil
+	}
+	if kid != "" {
+		key, ok := kr.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown master key id %q", kid)
+		}
+		if ver == 3 {
+			tenant, payload, err := splitTenant(body)
+			if err != nil {
+				return nil, err
+			}
+			key, body = kr.derive(kid, subkeyInfo(subkeyEnc, model, tenant)), payload
+		}
+		return gcmOpen(key, body, aad)
+	}
+	lastErr := errors.New("no master key")
+	for _, id := range kr.order {
+		plain, err := gcmOpen(kr.keys[id], body, nil)
+		if err == nil {
+			return plain, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// isCurrent گزارش می‌دهد که آیا مقدار با کلید فعال رمز شده است.
+func (kr *keyring) isCurrent(enc string) bool {
+	kid, _, _, err := splitKeyID(enc)
+	return err == nil && kid == kr.active
+}
+
+// cipherScope رکوردی است که ciphertextهای آن به آن گره می‌خورند. نام مدل بدون hash tag
+// استفاده می‌شود تا فعال کردن حالت کلاستر داده‌های موجود را نامعتبر نکند.
+type cipherScope struct {
+	ns, kind, model, id string
+}
+
+func (c *Client) recordScope(kind string, meta *ModelMetadata, id string) cipherScope {
+	return cipherScope{ns: c.ns, kind: kind, model: c.modelName(meta), id: id}
+}
+
+// aad داده احرازشده فیلد field (نام JSON) در این رکورد است.
+func (s cipherScope) aad(field string) []byte {
+	return recordAAD(s.ns, s.kind, s.model, s.id, field)
+}
+
+// fieldSealer فیلدهای محرمانه یک رکورد را رمز می‌کند. در حالت envelope تنها یک کلید داده
+// (DEK) برای کل رکورد صادر می‌شود و آن هم فقط در اولین استفاده.
+type fieldSealer struct {
+	c       *Client
+	ctx     context.Context
+	scope   cipherScope
+	tenant  string // tenant زیرکلید v3
+	dek     []byte
+	wrapped string
+}
+
+// newSealer یک sealer برای رکورد id از مدل meta می‌سازد؛ kind نوع کلید ("val" یا "pl") است.
+// tenant فقط در حالت WithKeyDerivation زیرکلید رمزنگاری را تعیین می‌کند.
+func (c *Client) newSealer(ctx context.Context, kind string, meta *ModelMetadata, id, tenant string) *fieldSealer {
+	return &fieldSealer{c: c, ctx: ctx, scope: c.recordScope(kind, meta, id), tenant: tenant}
+}
+
+// seal مقدار فیلد field (نام JSON) را در قالب v2 (یا v3 در حالت WithKeyDerivation) رمز می‌کند.
+func (s *fieldSealer) seal(field string, plain []byte) (string, error) {
+	aad := s.scope.aad(field)
+	if s.c.keyProvider == nil {
+		if s.c.deriveKeys {
+			return s.c.ring.sealDerived(plain, aad, s.scope.model, s.tenant)
+		}
+		return s.c.ring.seal(plain, aad)
+	}
+	if s.dek == nil {
+		dek, wrapped, err := s.c.keyProvider.GenerateDataKey(s.ctx)
+		if err != nil {
+			return "", fmt.Errorf("generate data key: %w", err)
+		}
+		if !validKeyLen(dek) {
+			return "", errors.New("data key must be 16, 24 or 32 bytes")
+		}
+		s.dek, s.wrapped = dek, base64.StdEncoding.EncodeToString(wrapped)
+	}
+	raw, err := gcmSeal(s.dek, plain, aad)
+	if err != nil {
+		return "", err
+	}
+	return envEncPrefixV2 + s.wrapped + ":" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// fieldOpener فیلدهای محرمانه را باز می‌کند و کلیدهای داده باز‌شده را برای فیلدهای
+// بعدی همان رکورد نگه می‌دارد تا برای هر فیلد یک فراخوانی KMS انجام نشود.
+type fieldOpener struct {
+	c     *Client
+	ctx   context.Context
+	scope cipherScope
+	deks  map[string][]byte
+}
+
+func (c *Client) newOpener(ctx context.Context, kind string, meta *ModelMetadata, id string) *fieldOpener {
+	return &fieldOpener{c: c, ctx: ctx, scope: c.recordScope(kind, meta, id)}
+}
+
+// open مقدار رمز‌شده فیلد field را باز می‌کند. مقادیر v2 و v3 فقط با همان رکورد و فیلدی که
+// برایش رمز شده‌اند باز می‌شوند؛ مقادیر v1 بدون AAD خوانده می‌شوند.
+func (o *fieldOpener) open(field, enc string) ([]byte, error) {
+	aad := o.scope.aad(field)
+	var body string
+	switch {
+	case strings.HasPrefix(enc, envEncPrefixV2):
+		body = enc[len(envEncPrefixV2):]
+	case strings.HasPrefix(enc, envEncPrefix):
+		body, aad = enc[len(envEncPrefix):], nil
+	default:
+		return o.c.ring.open(enc, aad, o.scope.model)
+	}
+	wrapped, payload, ok := strings.Cut(body, ":")
+	if !ok {
+		return nil, errors.New("invalid envelope ciphertext")
+	}
+	if o.c.keyProvider == nil {
+		return nil, errors.New("envelope ciphertext requires a key provider")
+	}
+	dek, ok := o.deks[wrapped]
+	if !ok {
+		raw, err := base64.StdEncoding.DecodeString(wrapped)
+		if err != nil {
+			return nil, err
+		}
+		if dek, err = o.c.keyProvider.DecryptDataKey(o.ctx, raw); err != nil {
+			return nil, fmt.Errorf("decrypt data key: %w", err)
+		}
+		if o.deks == nil {
+			o.deks = map[string][]byte{}
+		}
+		o.deks[wrapped] = dek
+	}
+	return gcmOpen(dek, payload, aad)
+}
+
+// isCurrentCiphertext گزارش می‌دهد که آیا مقدار با قالب و کلید فعال فعلی رمز شده است
+// یا باید در RotateKeys دوباره رمز شود.
+func (c *Client) isCurrentCiphertext(enc string) bool {
+	if c.keyProvider == nil {
+		want := fieldEncPrefixV2
+		if c.deriveKeys {
+			want = fieldEncPrefixV3
+		}
+		return strings.HasPrefix(enc, want) && c.ring.isCurrent(enc)
+	}
+	if !strings.HasPrefix(enc, envEncPrefixV2) {
+		return false
+	}
+	d, ok := c.keyProvider.(StaleKeyDetector)
+	if !ok {
+		return true
+	}
+	wrapped, _, _ := strings.Cut(enc[len(envEncPrefixV2):], ":")
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	return err == nil && !d.IsStale(raw)
+}
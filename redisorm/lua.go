@@ -7,93 +7,385 @@ else
   return 0
 end`
 
-const luaSave = `
--- KEYS: [verKey, valKey, newUniq..., delUniq..., addIdx..., remIdx..., addIdxEnc..., remIdxEnc...]
--- ARGV: [id, encJSON, ttl_ms, expectedVersion_or_empty, nNewUniq, nDelUniq, nAddIdx, nRemIdx, nAddIdxEnc, nRemIdxEnc]
-local idx = 1
-local verKey = KEYS[idx]; idx = idx + 1
-local valKey = KEYS[idx]; idx = idx + 1
+// luaShadowLib maintains the index/unique keys a record holds through its shadow hash
+// (slot -> key, e.g. "idx:Country" -> "ns:idx:User:Country:IR"). Callers only pass the new
+// keys; the old ones are read from the shadow, so the diff is computed atomically in the
+// script. Old keys share the model's hash tag, so they live in the same cluster slot.
+// Slot specs are slot names; a name prefixed with "-" clears the slot, any other name takes
+// the next key from KEYS as its new key. A unique slot name prefixed with "?" takes the next key
+// only as a guard: the value's key under a retired blind index key, which must not be held by
+// another live record but is never written. The "_" field marks a record as shadowed.
+// A unique key whose owner record no longer exists is stale and is taken over; unique keys
+// carry the TTL of their record, so the values of expired records are released as well.
+// In cluster mode every key a script touches is declared in KEYS: after its fixed keys the client
+// passes the keys it read from the shadow and the value keys of the current owners of its unique
+// keys. If either changed meanwhile, the script replies STALE_KEYS before writing and the client
+// retries with fresh keys. On a single node the client skips that read and shadowScript sets
+// checkDeclared to false, so the script reads these keys itself.
+const luaShadowLib = `
+local declared = {}
+for _, k in ipairs(KEYS) do declared[k] = true end
+local function readShadow(shdKey)
+  local shadow = {}
+  local flat = redis.call('HGETALL', shdKey)
+  for i=1,#flat,2 do shadow[flat[i]] = flat[i+1] end
+  return shadow
+end
+local function readSlots(shdKey, specs, firstKey)
+  local shadow = readShadow(shdKey)
+  local slots = {}
+  local k = firstKey
+  for _, spec in ipairs(specs) do
+    local mark = string.sub(spec, 1, 1)
+    if mark == '-' then
+      slots[#slots+1] = {string.sub(spec, 2), ''}
+    elseif mark == '?' then
+      slots[#slots+1] = {string.sub(spec, 2), KEYS[k], true}
+      k = k + 1
+    else
+      slots[#slots+1] = {spec, KEYS[k]}
+      k = k + 1
+    end
+  end
+  return shadow, slots, k
+end
+local function isUniq(slot) return string.sub(slot, 1, 4) == 'uniq' end
+-- the value keys of a model share the prefix of valKey, so the owner's key is derived from it
+local function ownerKey(valKey, id, owner)
+  return string.sub(valKey, 1, #valKey - #id) .. owner
+end
+local function ownerAlive(valKey, id, owner)
+  return redis.call('EXISTS', ownerKey(valKey, id, owner)) == 1
+end
+-- staleKeys reports whether the shadow or the owner of one of the unique slots ({slot, key})
+-- names a key that is not declared in KEYS
+local function staleKeys(shadow, slots, valKey, id)
+  if not checkDeclared then return false end
+  for slot, key in pairs(shadow) do
+    if slot ~= '_' and not declared[key] then return true end
+  end
+  for _, s in ipairs(slots) do
+    if isUniq(s[1]) and s[2] ~= '' then
+      local owner = redis.call('GET', s[2])
+      if owner and owner ~= id and not declared[ownerKey(valKey, id, owner)] then return true end
+    end
+  end
+  return false
+end
+local function uniqueFree(shadow, slots, id, valKey)
+  for _, s in ipairs(slots) do
+    if isUniq(s[1]) and s[2] ~= '' and (s[3] or shadow[s[1]] ~= s[2]) then
+      local owner = redis.call('GET', s[2])
+      if owner and owner ~= id and ownerAlive(valKey, id, owner) then return false end
+    end
+  end
+  return true
+end
+local function dropKey(slot, key, id)
+  if isUniq(slot) then
+    if redis.call('GET', key) == id then redis.call('DEL', key) end
+  else
+    redis.call('SREM', key, id)
+  end
+end
+local function applySlots(shdKey, shadow, slots, id)
+  redis.call('HSET', shdKey, '_', '1')
+  for _, s in ipairs(slots) do
+    local slot, new = s[1], s[2]
+    local old = shadow[slot]
+    if not s[3] and old ~= new then
+      if old then dropKey(slot, old, id) end
+      if new ~= '' then
+        if isUniq(slot) then redis.call('SET', new, id) else redis.call('SADD', new, id) end
+        redis.call('HSET', shdKey, slot, new)
+      elseif old then
+        redis.call('HDEL', shdKey, slot)
+      end
+    end
+  end
+end
+local function syncUniqTTL(shdKey, valKey, id)
+  local ttl = redis.call('PTTL', valKey)
+  local flat = redis.call('HGETALL', shdKey)
+  for i=1,#flat,2 do
+    if isUniq(flat[i]) and redis.call('GET', flat[i+1]) == id then
+      if ttl > 0 then redis.call('PEXPIRE', flat[i+1], ttl) else redis.call('PERSIST', flat[i+1]) end
+    end
+  end
+end
+local function clearSlots(shdKey, shadow, id)
+  for slot, key in pairs(shadow) do
+    if slot ~= '_' then dropKey(slot, key, id) end
+  end
+  redis.call('DEL', shdKey)
+end
+-- records written before shadows existed are seeded by the client (luaSeedShadow) first
+local function needsSeed(nSlots, shdKey, valKey)
+  return nSlots > 0 and redis.call('EXISTS', shdKey) == 0 and redis.call('EXISTS', valKey) == 1
+end
+`
+
+// luaCDCLib appends change events to the model's stream in the same script as the write and
+// publishes them to the record's watch channel. The cdc table holds {mode, model, maxLen,
+// channel} from ARGV; an empty mode disables capture, mode "doc" adds the stored document to
+// the stream entry and an empty channel disables notifications.
+const luaCDCLib = `
+-- documents are handled as raw member values instead of a cjson round trip, which would turn
+-- integers beyond 2^53 into doubles and empty arrays into {}
+local function skipString(s, i)
+  i = i + 1
+  while true do
+    local j = string.find(s, '["\\]', i)
+    if not j then return #s + 1 end
+    if string.sub(s, j, j) == '"' then return j + 1 end
+    i = j + 2
+  end
+end
+local function skipValue(s, i)
+  local c = string.sub(s, i, i)
+  if c == '"' then return skipString(s, i) end
+  if c ~= '{' and c ~= '[' then return string.find(s, '[,}%]%s]', i) or #s + 1 end
+  local depth = 0
+  while i <= #s do
+    local j = string.find(s, '["{}%[%]]', i)
+    if not j then break end
+    c = string.sub(s, j, j)
+    if c == '"' then
+      i = skipString(s, j)
+    else
+      if c == '{' or c == '[' then depth = depth + 1 else depth = depth - 1 end
+      i = j + 1
+      if depth == 0 then break end
+    end
+  end
+  return i
+end
+-- jsonFields returns the member names of a JSON object in document order and their raw values
+local function jsonFields(s)
+  local names, vals = {}, {}
+  local i = (string.find(s, '{', 1, true) or #s) + 1
+  while true do
+    i = string.find(s, '[^%s,]', i)
+    if not i or string.sub(s, i, i) ~= '"' then break end
+    local e = skipString(s, i)
+    local name = string.sub(s, i + 1, e - 2)
+    if string.find(name, '\\', 1, true) then name = cjson.decode('[' .. string.sub(s, i, e - 1) .. ']')[1] end
+    i = string.find(s, '%S', (string.find(s, ':', e, true) or #s) + 1)
+    if not i then break end
+    e = skipValue(s, i)
+    names[#names+1] = name
+    vals[name] = string.sub(s, i, e - 1)
+    i = e
+  end
+  return names, vals
+end
+local function jsonObject(names, vals)
+  local parts = {}
+  for _, k in ipairs(names) do parts[#parts+1] = cjson.encode(k) .. ':' .. vals[k] end
+  return '{' .. table.concat(parts, ',') .. '}'
+end
+local function changedFields(oldJson, newJson)
+  local a = {}
+  if oldJson then a = select(2, jsonFields(oldJson)) end
+  local names, b = jsonFields(newJson)
+  local out = {}
+  for _, k in ipairs(names) do
+    if a[k] ~= b[k] then out[#out+1] = k end
+  end
+  for k in pairs(a) do
+    if b[k] == nil then out[#out+1] = k end
+  end
+  table.sort(out)
+  return out
+end
+-- history models keep their last histMax documents in a capped stream, keyed by version
+local function recordHistory(histKey, histMax, version, doc)
+  if histMax > 0 then
+    redis.call('XADD', histKey, 'MAXLEN', histMax, '*', 'version', tostring(version), 'doc', doc)
+  end
+end
+-- audited models append who changed what to the record's audit stream and, when the write has
+-- an actor, to the actor's stream. The audit table holds {mode, maxLen, actor, service, request,
+-- secrets} from ARGV; the diff maps each changed field to its old and new value, except secret
+-- fields, which are only marked as changed.
+local function recordAudit(recKey, actorKey, audit, op, id, version, oldJson, newJson)
+  if audit[1] == '' then return end
+  local names, a, b = {}, {}, {}
+  if oldJson then a = select(2, jsonFields(oldJson)) end
+  if newJson then names, b = jsonFields(newJson) end
+  local secret = {}
+  for _, k in ipairs(cjson.decode(audit[6])) do secret[k] = true end
+  local diff = {}
+  local function add(k, old, new)
+    local change = {}
+    if secret[k] then
+      change[1] = '"masked":true'
+    else
+      if old then change[#change+1] = '"old":' .. old end
+      if new then change[#change+1] = '"new":' .. new end
+    end
+    diff[#diff+1] = cjson.encode(k) .. ':{' .. table.concat(change, ',') .. '}'
+  end
+  for _, k in ipairs(names) do
+    if a[k] ~= b[k] then add(k, a[k], b[k]) end
+  end
+  for k, v in pairs(a) do
+    if b[k] == nil then add(k, v, nil) end
+  end
+  local entry = {'*', 'op', op, 'id', id, 'version', tostring(version), 'actor', audit[3],
+    'service', audit[4], 'request', audit[5], 'diff', '{' .. table.concat(diff, ',') .. '}'}
+  local maxLen = tonumber(audit[2]) or 0
+  local targets = {recKey}
+  if audit[3] ~= '' then targets[2] = actorKey end
+  for _, key in ipairs(targets) do
+    local args = {'XADD', key}
+    if maxLen > 0 then
+      args[#args+1] = 'MAXLEN'
+      args[#args+1] = '~'
+      args[#args+1] = maxLen
+    end
+    for _, v in ipairs(entry) do args[#args+1] = v end
+    redis.call(unpack(args))
+  end
+end
+local function emitChange(stream, cdc, op, id, version, fields, doc)
+  local list = '[]'
+  if #fields > 0 then list = cjson.encode(fields) end
+  if cdc[4] ~= '' then
+    redis.call('PUBLISH', cdc[4], '{"op":' .. cjson.encode(op) .. ',"model":' .. cjson.encode(cdc[2]) ..
+      ',"id":' .. cjson.encode(id) .. ',"version":' .. (tonumber(version) or 0) .. ',"fields":' .. list .. '}')
+  end
+  if cdc[1] == '' then return end
+  local args = {'XADD', stream}
+  local maxLen = tonumber(cdc[3]) or 0
+  if maxLen > 0 then
+    args[#args+1] = 'MAXLEN'
+    args[#args+1] = '~'
+    args[#args+1] = maxLen
+  end
+  for _, v in ipairs({'*', 'op', op, 'model', cdc[2], 'id', id, 'version', tostring(version), 'fields', list}) do
+    args[#args+1] = v
+  end
+  if cdc[1] == 'doc' and doc then
+    args[#args+1] = 'doc'
+    args[#args+1] = doc
+  end
+  redis.call(unpack(args))
+end
+`
+
+const luaSave = luaShadowLib + luaCDCLib + `
+-- KEYS: [verKey, valKey, shdKey, cdcKey, histKey, auditKey, actorAuditKey, seqKey, slotKey..., addRange...,
+--        remRange..., shadowKey..., ownerValKey...]
+-- ARGV: [id, encJSON, ttl_ms, expectedVersion_or_empty, nSlots, nAddRange, nRemRange,
+--        cdcMode, cdcModel, cdcMaxLen, cdcChannel, histMax, auditMode, auditMaxLen, actor, service,
+--        request, secrets, seqFloor, slotSpec..., rangeScore...]
+-- returns the version of the record after the write
+local verKey, valKey, shdKey, cdcKey, histKey = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
 local id = ARGV[1]
 local enc = ARGV[2]
 local ttl = tonumber(ARGV[3]) or 0
 local expected = tostring(ARGV[4])
-local nNewUniq = tonumber(ARGV[5]) or 0
-local nDelUniq = tonumber(ARGV[6]) or 0
-local nAddIdx = tonumber(ARGV[7]) or 0
-local nRemIdx = tonumber(ARGV[8]) or 0
-local nAddIdxEnc = tonumber(ARGV[9]) or 0
-local nRemIdxEnc = tonumber(ARGV[10]) or 0
+local nSlots = tonumber(ARGV[5]) or 0
+local nAddRange = tonumber(ARGV[6]) or 0
+local nRemRange = tonumber(ARGV[7]) or 0
+local cdc = {ARGV[8], ARGV[9], ARGV[10], ARGV[11]}
+local capture = cdc[1] ~= '' or cdc[4] ~= ''
+local histMax = tonumber(ARGV[12]) or 0
+local audit = {ARGV[13], ARGV[14], ARGV[15], ARGV[16], ARGV[17], ARGV[18]}
 if expected ~= nil and expected ~= '' then
   local cur = tonumber(redis.call('GET', verKey) or '0')
   if cur ~= tonumber(expected) then return redis.error_reply('VERSION_CONFLICT') end
 end
-for i=0,nNewUniq-1 do
-  local k = KEYS[idx + i]
-  local v = redis.call('GET', k)
-  if v and v ~= id then return redis.error_reply('UNIQUE_CONFLICT') end
+local old = false
+if capture or audit[1] ~= '' then old = redis.call('GET', valKey) end
+if needsSeed(nSlots, shdKey, valKey) then return redis.error_reply('NO_SHADOW') end
+local shadow, slots, idx = readSlots(shdKey, {unpack(ARGV, 20, 19 + nSlots)}, 9)
+if staleKeys(shadow, slots, valKey, id) then return redis.error_reply('STALE_KEYS') end
+if not uniqueFree(shadow, slots, id, valKey) then return redis.error_reply('UNIQUE_CONFLICT') end
+-- a manually assigned seq id raises the sequence so that later INCRs never hand it out
+local seqFloor = tonumber(ARGV[19]) or 0
+if seqFloor > tonumber(redis.call('GET', KEYS[8]) or '0') then redis.call('SET', KEYS[8], ARGV[19]) end
+-- every write of a history model is a new version; the client leaves a placeholder in the
+-- version field of non-optimistic saves, which is replaced without re-encoding the document
+if histMax > 0 and expected == '' then
+  local ver = redis.call('INCR', verKey)
+  local mark = '"\\u0000redisorm:version\\u0000"'
+  local s, e = string.find(enc, mark, 1, true)
+  if s then enc = string.sub(enc, 1, s - 1) .. ver .. string.sub(enc, e + 1) end
 end
-idx = idx + nNewUniq
 if ttl > 0 then
   redis.call('PSETEX', valKey, ttl, enc)
 else
   redis.call('SET', valKey, enc)
 end
-for i=0,nNewUniq-1 do
-  local k = KEYS[idx - nNewUniq + i]
-  redis.call('SET', k, id)
-end
-for i=0,nDelUniq-1 do
-  local k = KEYS[idx + i]
-  if redis.call('GET', k) == id then redis.call('DEL', k) end
+if nSlots > 0 then
+  applySlots(shdKey, shadow, slots, id)
+  syncUniqTTL(shdKey, valKey, id)
 end
-idx = idx + nDelUniq
-for i=0,nAddIdx-1 do
-  redis.call('SADD', KEYS[idx + i], id)
+for i=0,nAddRange-1 do
+  redis.call('ZADD', KEYS[idx + i], ARGV[20 + nSlots + i], id)
 end
-idx = idx + nAddIdx
-for i=0,nRemIdx-1 do
-  redis.call('SREM', KEYS[idx + i], id)
-end
-idx = idx + nRemIdx
-for i=0,nAddIdxEnc-1 do
-  redis.call('SADD', KEYS[idx + i], id)
-end
-idx = idx + nAddIdxEnc
-for i=0,nRemIdxEnc-1 do
-  redis.call('SREM', KEYS[idx + i], id)
+idx = idx + nAddRange
+for i=0,nRemRange-1 do
+  redis.call('ZREM', KEYS[idx + i], id)
 end
 if expected ~= nil and expected ~= '' then
   redis.call('SET', verKey, tonumber(expected) + 1)
 end
-return id
+local version = redis.call('GET', verKey) or '0'
+recordHistory(histKey, histMax, version, enc)
+local op = 'update'
+if not old then op = 'create' end
+recordAudit(KEYS[6], KEYS[7], audit, op, id, version, old, enc)
+if capture then
+  emitChange(cdcKey, cdc, op, id, version, changedFields(old, enc), enc)
+end
+return tonumber(version)
 `
 
-const luaDelete = `
--- KEYS: [verKey, valKey, delUniq..., remIdx..., remIdxEnc...]
--- ARGV: [id, expectedVersion_or_empty, removeVer(0/1), nDelUniq, nRemIdx, nRemIdxEnc]
-local idx = 1
-local verKey = KEYS[idx]; idx = idx + 1
-local valKey = KEYS[idx]; idx = idx + 1
+const luaDelete = luaShadowLib + luaCDCLib + `
+-- KEYS: [verKey, valKey, shdKey, cdcKey, histKey, auditKey, actorAuditKey, remRange..., shadowKey...]
+-- ARGV: [id, expectedVersion_or_empty, removeVer(0/1), hasSlots(0/1), cdcMode, cdcModel, cdcMaxLen, cdcChannel,
+--        auditMode, auditMaxLen, actor, service, request, secrets, nRemRange]
+-- the history stream outlives the record, and so does the version key while history exists, so
+-- that a record saved again under the same id continues its version numbers
+local verKey, valKey, shdKey, cdcKey, histKey = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
 local id = ARGV[1]
 local expected = tostring(ARGV[2])
 local rmver = tostring(ARGV[3])
-local nDelUniq = tonumber(ARGV[4]) or 0
-local nRemIdx = tonumber(ARGV[5]) or 0
-local nRemIdxEnc = tonumber(ARGV[6]) or 0
 if expected ~= nil and expected ~= '' then
   local cur = tonumber(redis.call('GET', verKey) or '0')
   if cur ~= tonumber(expected) then return redis.error_reply('VERSION_CONFLICT') end
 end
-redis.call('DEL', valKey)
-for i=0,nDelUniq-1 do
-  local k = KEYS[idx + i]
-  if redis.call('GET', k) == id then redis.call('DEL', k) end
+if needsSeed(tonumber(ARGV[4]) or 0, shdKey, valKey) then return redis.error_reply('NO_SHADOW') end
+local shadow = readShadow(shdKey)
+if staleKeys(shadow, {}, valKey, id) then return redis.error_reply('STALE_KEYS') end
+local version = redis.call('GET', verKey) or '0'
+local audit = {ARGV[9], ARGV[10], ARGV[11], ARGV[12], ARGV[13], ARGV[14]}
+local old = false
+if audit[1] ~= '' then old = redis.call('GET', valKey) end
+local existed = redis.call('DEL', valKey)
+clearSlots(shdKey, shadow, id)
+for i=8,7 + (tonumber(ARGV[15]) or 0) do redis.call('ZREM', KEYS[i], id) end
+if rmver == '1' and redis.call('EXISTS', histKey) == 0 then redis.call('DEL', verKey) end
+if existed == 1 then
+  recordAudit(KEYS[6], KEYS[7], audit, 'delete', id, version, old, nil)
+  emitChange(cdcKey, {ARGV[5], ARGV[6], ARGV[7], ARGV[8]}, 'delete', id, version, {}, nil)
+end
+return 1
+`
+
+const luaSeedShadow = `
+-- KEYS: [valKey, shdKey, slotKey...]
+-- ARGV: [expectedValue, slotName...]
+-- records the index keys of a record written before shadows existed, unless it changed meanwhile
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+if redis.call('EXISTS', KEYS[2]) == 1 then return 1 end
+redis.call('HSET', KEYS[2], '_', '1')
+for i=2,#ARGV do
+  redis.call('HSET', KEYS[2], ARGV[i], KEYS[i + 1])
 end
-idx = idx + nDelUniq
-for i=0,nRemIdx-1 do redis.call('SREM', KEYS[idx + i], id) end
-idx = idx + nRemIdx
-for i=0,nRemIdxEnc-1 do redis.call('SREM', KEYS[idx + i], id) end
-if rmver == '1' then redis.call('DEL', verKey) end
 return 1
 `
 
@@ -111,21 +403,249 @@ end
 return 1
 `
 
-const luaUpdateFieldsFast = `
--- KEYS: [valKey]
--- ARGV: [updates_json_string]
-local valKey = KEYS[1]
-local updatesJson = ARGV[1]
-if redis.call("EXISTS", valKey) == 0 then
+const luaUpdateFieldsFast = luaShadowLib + luaCDCLib + `
+-- KEYS: [valKey, verKey, shdKey, cdcKey, histKey, auditKey, actorAuditKey, slotKey..., addRange..., remRange...,
+--        shadowKey..., ownerValKey...]
+-- ARGV: [updates_json, expectedVersion_or_empty, versionField_or_empty, autoUpdate_json, id,
+--        nSlots, nAddRange, nRemRange, cdcMode, cdcModel, cdcMaxLen, cdcChannel, histMax, auditMode,
+--        auditMaxLen, actor, service, request, secrets, slotSpec..., rangeScore...]
+-- returns the JSON names of the fields whose value changed
+local valKey, verKey, shdKey, cdcKey, histKey = KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5]
+local expected = ARGV[2]
+local versionField = ARGV[3]
+local id = ARGV[5]
+local nSlots = tonumber(ARGV[6]) or 0
+local nAddRange = tonumber(ARGV[7]) or 0
+local nRemRange = tonumber(ARGV[8]) or 0
+local cdc = {ARGV[9], ARGV[10], ARGV[11], ARGV[12]}
+local histMax = tonumber(ARGV[13]) or 0
+local audit = {ARGV[14], ARGV[15], ARGV[16], ARGV[17], ARGV[18], ARGV[19]}
+local currentJson = redis.call("GET", valKey)
+if not currentJson then
   return redis.error_reply('NOT_FOUND')
 end
-local currentJson = redis.call("GET", valKey)
-local currentData = cjson.decode(currentJson)
-local updatesData = cjson.decode(updatesJson)
-for k, v in pairs(updatesData) do
-  currentData[k] = v
+local names, fields = jsonFields(currentJson)
+local function set(k, v)
+  if fields[k] == nil then names[#names+1] = k end
+  fields[k] = v
+end
+-- a record without a version counter continues from the version stored in its document
+local curVer = redis.call('GET', verKey)
+if curVer then
+  curVer = tonumber(curVer)
+else
+  curVer = (versionField ~= '' and tonumber(fields[versionField] or '')) or 0
+end
+if expected ~= '' and curVer ~= tonumber(expected) then
+  return redis.error_reply('VERSION_CONFLICT')
+end
+local changed = {}
+local updNames, updates = jsonFields(ARGV[1])
+for _, k in ipairs(updNames) do
+  if fields[k] ~= updates[k] then
+    set(k, updates[k])
+    changed[#changed+1] = k
+  end
+end
+if #changed == 0 then return changed end
+if needsSeed(nSlots, shdKey, valKey) then return redis.error_reply('NO_SHADOW') end
+local shadow, slots, idx = readSlots(shdKey, {unpack(ARGV, 20, 19 + nSlots)}, 8)
+if staleKeys(shadow, slots, valKey, id) then return redis.error_reply('STALE_KEYS') end
+if not uniqueFree(shadow, slots, id, valKey) then return redis.error_reply('UNIQUE_CONFLICT') end
+local autoNames, auto = jsonFields(ARGV[4])
+for _, k in ipairs(autoNames) do set(k, auto[k]) end
+if versionField ~= '' or histMax > 0 then
+  curVer = curVer + 1
+  redis.call('SET', verKey, curVer)
+  if versionField ~= '' then set(versionField, string.format('%d', curVer)) end
+end
+local newJson = jsonObject(names, fields)
+redis.call("SET", valKey, newJson, "KEEPTTL")
+if nSlots > 0 then
+  applySlots(shdKey, shadow, slots, id)
+  syncUniqTTL(shdKey, valKey, id)
+end
+for i=0,nAddRange-1 do redis.call('ZADD', KEYS[idx + i], ARGV[20 + nSlots + i], id) end
+idx = idx + nAddRange
+for i=0,nRemRange-1 do redis.call('ZREM', KEYS[idx + i], id) end
+recordHistory(histKey, histMax, curVer, newJson)
+recordAudit(KEYS[6], KEYS[7], audit, 'update', id, curVer, currentJson, newJson)
+emitChange(cdcKey, cdc, 'update', id, curVer, changed, newJson)
+return changed
+`
+
+const luaQuery = `
+-- KEYS: [tmpKey, firstSet, set..., sortKey (only when ordered)]
+-- ARGV: [ops (one char per set after the first: A=inter, O=union, N=diff), offset, limit (-1 = all, 0 = count only),
+--        order ('' | 'asc' | 'desc'), cursorScore, cursorId]
+local tmp = KEYS[1]
+local ops = ARGV[1]
+local offset = tonumber(ARGV[2]) or 0
+local limit = tonumber(ARGV[3]) or -1
+local order = ARGV[4] or ''
+local lastSet = #KEYS
+if order ~= '' then lastSet = lastSet - 1 end
+redis.call('SUNIONSTORE', tmp, KEYS[2])
+for i=3,lastSet do
+  local op = string.sub(ops, i-2, i-2)
+  if op == 'A' then
+    redis.call('SINTERSTORE', tmp, tmp, KEYS[i])
+  elseif op == 'O' then
+    redis.call('SUNIONSTORE', tmp, tmp, KEYS[i])
+  elseif op == 'N' then
+    redis.call('SDIFFSTORE', tmp, tmp, KEYS[i])
+  end
+end
+if order == '' then
+  local total = redis.call('SCARD', tmp)
+  local ids = {}
+  if limit ~= 0 and total > 0 then
+    if limit < 0 then limit = total end
+    ids = redis.call('SORT', tmp, 'ALPHA', 'LIMIT', offset, limit)
+  end
+  redis.call('DEL', tmp)
+  return {total, ids}
+end
+-- records without a score for the sort field drop out of the intersection
+redis.call('ZINTERSTORE', tmp, 2, KEYS[#KEYS], tmp, 'WEIGHTS', 1, 0)
+local total = redis.call('ZCARD', tmp)
+local out = {}
+if limit ~= 0 and total > 0 then
+  if limit < 0 then limit = total end
+  local curScore = ARGV[5] or ''
+  local curId = ARGV[6] or ''
+  if curId == '' then
+    if order == 'desc' then
+      out = redis.call('ZREVRANGE', tmp, offset, offset + limit - 1, 'WITHSCORES')
+    else
+      out = redis.call('ZRANGE', tmp, offset, offset + limit - 1, 'WITHSCORES')
+    end
+  else
+    -- resume strictly after (curScore, curId): count the entries before the cursor's score, then
+    -- binary search its ties, which are ordered by member; the cursor need not still exist
+    local range, lo = 'ZRANGE', redis.call('ZCOUNT', tmp, '-inf', '(' .. curScore)
+    if order == 'desc' then
+      range, lo = 'ZREVRANGE', redis.call('ZCOUNT', tmp, '(' .. curScore, '+inf')
+    end
+    local hi = lo + redis.call('ZCOUNT', tmp, curScore, curScore)
+    while lo < hi do
+      local mid = math.floor((lo + hi) / 2)
+      local m = redis.call(range, tmp, mid, mid)[1]
+      local past
+      if order == 'desc' then past = m < curId else past = m > curId end
+      if past then hi = mid else lo = mid + 1 end
+    end
+    out = redis.call(range, tmp, lo, lo + limit - 1, 'WITHSCORES')
+  end
+end
+redis.call('DEL', tmp)
+return {total, out}
+`
+
+const luaRotate = luaShadowLib + `
+-- KEYS: [key, shdKey, encSlotKey..., shadowKey..., ownerValKey...]   (only key for payloads)
+-- ARGV: [expectedValue, newValue, id, encSlotName...]
+-- compare-and-set: a concurrent write already used the active key, so it wins
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+if #KEYS == 1 then
+  if ARGV[2] ~= ARGV[1] then redis.call('SET', KEYS[1], ARGV[2], 'KEEPTTL') end
+  return 1
 end
-local newJson = cjson.encode(currentData)
-redis.call("SET", valKey, newJson)
+local valKey, shdKey, id = KEYS[1], KEYS[2], ARGV[3]
+local shadow = readShadow(shdKey)
+local slots = {}
+for i=4,#ARGV do slots[#slots+1] = {ARGV[i], KEYS[i - 1]} end
+if staleKeys(shadow, slots, valKey, id) then return redis.error_reply('STALE_KEYS') end
+if ARGV[2] ~= ARGV[1] then
+  redis.call('SET', valKey, ARGV[2], 'KEEPTTL')
+end
+-- the entries under the retired key are the ones in the shadow; records without a shadow are
+-- seeded from their document on the next write and their old entries are left to Repair
+local shadowed = shadow['_'] ~= nil
+for _, s in ipairs(slots) do
+  local slot, key = s[1], s[2]
+  local old = shadow[slot]
+  if old and old ~= key then dropKey(slot, old, id) end
+  if isUniq(slot) then
+    local owner = redis.call('GET', key)
+    if not owner or owner == id or not ownerAlive(valKey, id, owner) then
+      local ttl = redis.call('PTTL', valKey)
+      if ttl > 0 then redis.call('PSETEX', key, ttl, id) else redis.call('SET', key, id) end
+    end
+    if shadowed then
+      if redis.call('GET', key) == id then redis.call('HSET', shdKey, slot, key) else redis.call('HDEL', shdKey, slot) end
+    end
+  else
+    redis.call('SADD', key, id)
+    if shadowed then redis.call('HSET', shdKey, slot, key) end
+  end
+end
+return 1
+`
+
+const luaReap = luaShadowLib + `
+-- KEYS: [verKey, valKey, shdKey, histKey, rangeKey..., shadowKey...]
+-- ARGV: [id, nRange]
+-- removes the index, unique and range entries left behind by an expired record; the history
+-- stream is kept, and so is the version key while history exists, so that a record saved again
+-- under the same id continues its version numbers
+if redis.call('EXISTS', KEYS[2]) == 1 then return 0 end
+local shadow = readShadow(KEYS[3])
+if staleKeys(shadow, {}, KEYS[2], ARGV[1]) then return redis.error_reply('STALE_KEYS') end
+clearSlots(KEYS[3], shadow, ARGV[1])
+for i=5,4 + (tonumber(ARGV[2]) or 0) do redis.call('ZREM', KEYS[i], ARGV[1]) end
+if redis.call('EXISTS', KEYS[4]) == 0 then redis.call('DEL', KEYS[1]) end
+return 1
+`
+
+const luaRepairDrop = `
+-- KEYS: [indexKey, valKey]
+-- ARGV: [id, expectedValue] (an empty expectedValue means the record is absent)
+-- removes a dangling index member or unique key, unless the record changed meanwhile
+if (redis.call('GET', KEYS[2]) or '') ~= ARGV[2] then return 0 end
+if redis.call('TYPE', KEYS[1]).ok == 'set' then
+  return redis.call('SREM', KEYS[1], ARGV[1])
+end
+if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0
+`
+
+const luaRepairRecord = luaShadowLib + `
+-- KEYS: [valKey, shdKey, slotKey..., ownerValKey...]
+-- ARGV: [expectedValue, id, slotName...]
+-- adds the missing index entries of a record and rewrites its shadow, unless it changed
+-- meanwhile; a unique key held by another live record is left to that record
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+local valKey, shdKey, id = KEYS[1], KEYS[2], ARGV[2]
+local slots = {}
+for i=3,#ARGV do slots[#slots+1] = {ARGV[i], KEYS[i]} end
+if staleKeys({}, slots, valKey, id) then return redis.error_reply('STALE_KEYS') end
+redis.call('DEL', shdKey)
+redis.call('HSET', shdKey, '_', '1')
+for i=3,#ARGV do
+  local slot, key = ARGV[i], KEYS[i]
+  if isUniq(slot) then
+    local owner = redis.call('GET', key)
+    if not owner or not ownerAlive(valKey, id, owner) then redis.call('SET', key, id) end
+    if redis.call('GET', key) == id then redis.call('HSET', shdKey, slot, key) end
+  else
+    redis.call('SADD', key, id)
+    redis.call('HSET', shdKey, slot, key)
+  end
+end
+syncUniqTTL(shdKey, valKey, id)
+return 1
+`
+
+const luaTouch = luaShadowLib + `
+-- KEYS: [valKey, shdKey, shadowKey...]
+-- ARGV: [id, ttl_ms, hasSlots(0/1)]
+-- extends the TTL of a record together with its unique keys
+local valKey, shdKey, id = KEYS[1], KEYS[2], ARGV[1]
+if redis.call('EXISTS', valKey) == 0 then return 0 end
+if needsSeed(tonumber(ARGV[3]) or 0, shdKey, valKey) then return redis.error_reply('NO_SHADOW') end
+if staleKeys(readShadow(shdKey), {}, valKey, id) then return redis.error_reply('STALE_KEYS') end
+redis.call('PEXPIRE', valKey, ARGV[2])
+syncUniqTTL(shdKey, valKey, id)
 return 1
 `
@@ -70,6 +70,18 @@ func ensurePrimaryKey(v any, meta *ModelMetadata) (string, error) {
 	if len(meta.PKFields) == 0 {
 		return "", errors.New("no pk field (tag `redis:\"pk\"` or field ID)")
 	}
+	if len(meta.PKFields) > 1 {
+		// اجزای کلید ترکیبی به صورت خودکار تولید نمی‌شوند (مگر با تگ default)؛ جزء عددی 0 معتبر است.
+		parts := make([]string, 0, len(meta.PKFields))
+		for _, name := range meta.PKFields {
+			fv := rv.FieldByName(name)
+			if !fv.IsValid() || pkPartMissing(fv, true) {
+				return "", fmt.Errorf("composite primary key field %s must be set", name)
+			}
+			parts = append(parts, fmt.Sprint(fv.Interface()))
+		}
+		return joinID(parts), nil
+	}
 	pkFieldName := meta.PKFields[0]
 	fv := rv.FieldByName(pkFieldName)
 
@@ -99,23 +111,7 @@ func readPrimaryKey(v any, meta *ModelMetadata) (string, error) {
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
 		return "", errors.New("dst must be non-nil pointer")
 	}
-	rv = rv.Elem()
-
-	if len(meta.PKFields) == 0 {
-		return "", errors.New("no pk field")
-	}
-	pkFieldName := meta.PKFields[0]
-	fv := rv.FieldByName(pkFieldName)
-
-	if !fv.IsValid() {
-		return "", errors.New("pk field is not valid")
-	}
-
-	if isZero(fv) {
-		return "", nil
-	}
-
-	return fmt.Sprint(fv.Interface()), nil
+	return pkFromValue(rv.Elem(), meta)
 }
 func applyDefaults(v any, meta *ModelMetadata) {
 	rv := reflect.ValueOf(v)
@@ -127,7 +123,7 @@ func applyDefaults(v any, meta *ModelMetadata) {
 
 	for fieldName, tag := range meta.DefaultFields {
 		fv := rv.FieldByName(fieldName)
-		if !fv.CanSet() || !isZero(fv) {
+		if !fv.CanSet() || !isZero(fv) || isIDStrategy(tag) {
 			continue
 		}
 		switch fv.Kind() {
@@ -195,74 +191,26 @@ func parseInt64(s string) (int64, error) {
 	return n, err
 }
 
-func versionPointer(v any) (*int64, int) {
+// versionPointer فیلد version را (در سطح اول یا داخل struct جاسازی‌شده) پیدا می‌کند.
+func versionPointer(v any) *int64 {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
-		return nil, -1
+		return nil
 	}
 	rv = rv.Elem()
-	rt := rv.Type()
-	for i := 0; i < rt.NumField(); i++ {
-		f := rt.Field(i)
-		if f.Type.Kind() == reflect.Int64 && (strings.EqualFold(f.Name, "Version") || f.Tag.Get("redis") == "version") {
-			fv := rv.Field(i)
-			return fv.Addr().Interface().(*int64), i
+	for _, f := range reflect.VisibleFields(rv.Type()) {
+		if !f.IsExported() || f.Type.Kind() != reflect.Int64 {
+			continue
+		}
+		if strings.EqualFold(f.Name, "Version") || parseRedisTag(f.Tag.Get("redis")).Name == "version" {
+			return rv.FieldByIndex(f.Index).Addr().Interface().(*int64)
 		}
 	}
-	return nil, -1
+	return nil
 }
 
 func setVersion(v any, val int64) {
-	ptr, idx := versionPointer(v)
-	if ptr == nil {
-		return
-	}
-	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Pointer || rv.IsNil() {
-		return
-	}
-	rv = rv.Elem()
-	rv.Field(idx).SetInt(val)
-}
-
-func toJSONNative(v reflect.Value) any {
-	if v.Kind() == reflect.Pointer {
-		if v.IsNil() {
-			return nil
-		}
-		return toJSONNative(v.Elem())
-	}
-	switch v.Kind() {
-	case reflect.String:
-		return v.String()
-	case reflect.Bool:
-		return v.Bool()
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return v.Int()
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return v.Uint()
-	case reflect.Float32, reflect.Float64:
-		return v.Float()
-	case reflect.Slice:
-		if v.Type().Elem().Kind() == reflect.Uint8 {
-			return v.Bytes()
-		}
-		n := v.Len()
-		a := make([]any, n)
-		for i := 0; i < n; i++ {
-			a[i] = toJSONNative(v.Index(i))
-		}
-		return a
-	case reflect.Map:
-		iter := v.MapRange()
-		m := make(map[string]any)
-		for iter.Next() {
-			m[fmt.Sprint(iter.Key().Interface())] = toJSONNative(iter.Value())
-		}
-		return m
-	case reflect.Struct:
-		return v.Interface()
-	default:
-		return v.Interface()
+	if ptr := versionPointer(v); ptr != nil {
+		*ptr = val
 	}
 }
\ No newline at end of file
@@ -2,6 +2,7 @@ package redisorm
 
 import (
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -11,18 +12,28 @@ type ModelMetadata struct {
 	StructName    string
 	GroupName     string
 	AutoDeleteTTL time.Duration // >>>>>>>>> NEW <<<<<<<<<
+	Capture       *ChangeCapture // تنظیمات ثبت تغییرات؛ nil یعنی غیرفعال
+	HistorySize   int64          // تعداد نسخه‌های نگه‌داشته‌شده در تاریخچه (تگ history=N)
+	Audit         *AuditTrail    // تنظیمات ثبت سابقه تغییرات؛ nil یعنی غیرفعال
 
-	JsonNames map[string]string
+	JsonNames  map[string]string
+	JsonPaths  map[string][]string // مسیر JSON هر فیلد؛ برای فیلدهای تودرتو بیش از یک جزء دارد
+	FieldTypes map[string]reflect.Type
 
 	PKFields             []string
 	VersionFields        []string
 	IndexedFields        []string
 	EncIndexedFields     []string
 	UniqueFields         []string
+	EncUniqueFields      []string
+	RangeFields          []string
+	SortField            string
 	SecretFields         []string
 	DefaultFields        map[string]string
 	AutoCreateTimeFields []string
 	AutoUpdateTimeFields []string
+
+	fields []modelField
 }
 
 // getModelMetadata یک struct را تحلیل کرده و نتایج را در کش ذخیره می‌کند.
@@ -38,6 +49,8 @@ func (c *Client) getModelMetadata(v any) (*ModelMetadata, error) {
 
 	meta := &ModelMetadata{
 		JsonNames:     make(map[string]string),
+		JsonPaths:     make(map[string][]string),
+		FieldTypes:    make(map[string]reflect.Type),
 		DefaultFields: make(map[string]string),
 	}
 
@@ -58,50 +71,76 @@ func (c *Client) getModelMetadata(v any) (*ModelMetadata, error) {
 		meta.AutoDeleteTTL = autoDeleter.AutoDeleteTTL()
 	}
 
-	for i := 0; i < rt.NumField(); i++ {
-		f := rt.Field(i)
-		if f.PkgPath != "" {
-			continue
-		}
+	if capturer, ok := modelInstance.(ChangeCapturer); ok {
+		capture := capturer.ChangeCapture()
+		meta.Capture = &capture
+	}
+	if auditor, ok := modelInstance.(Auditor); ok {
+		trail := auditor.AuditTrail()
+		meta.Audit = &trail
+	}
 
+	meta.fields = collectFields(rt)
+	idField := ""
+	for _, f := range meta.fields {
 		fieldName := f.Name
-		jsonName := fieldName
-		if tag := f.Tag.Get("json"); tag != "" {
-			name := strings.Split(tag, ",")[0]
-			if name != "" && name != "-" {
-				jsonName = name
-			}
-		}
-		meta.JsonNames[fieldName] = jsonName
+		meta.JsonNames[fieldName] = strings.Join(f.JSONPath, ".")
+		meta.JsonPaths[fieldName] = f.JSONPath
+		meta.FieldTypes[fieldName] = f.Type
 
-		redisTag := f.Tag.Get("redis")
-		if redisTag == "pk" || strings.EqualFold(fieldName, "ID") {
-			meta.PKFields = append(meta.PKFields, fieldName)
+		tag := f.Tag
+		if tag.Name == "-" {
+			continue
 		}
-		if redisTag == "version" || strings.EqualFold(fieldName, "Version") {
-			meta.VersionFields = append(meta.VersionFields, fieldName)
+		// pk، version، زمان‌ها، secret و default فقط روی فیلدهای سطح اول (یا جاسازی‌شده) معنا دارند.
+		if !f.Nested {
+			// همه فیلدهای دارای تگ pk (به ترتیب تعریف) کلید اصلی ترکیبی را می‌سازند.
+			if tag.Name == "pk" {
+				meta.PKFields = append(meta.PKFields, fieldName)
+			} else if strings.EqualFold(fieldName, "ID") {
+				idField = fieldName
+			}
+			if tag.Name == "version" || strings.EqualFold(fieldName, "Version") {
+				meta.VersionFields = append(meta.VersionFields, fieldName)
+			}
+			if tag.has("auto_create_time") {
+				meta.AutoCreateTimeFields = append(meta.AutoCreateTimeFields, fieldName)
+			}
+			if tag.has("auto_update_time") {
+				meta.AutoUpdateTimeFields = append(meta.AutoUpdateTimeFields, fieldName)
+			}
+			if f.Secret == "true" {
+				meta.SecretFields = append(meta.SecretFields, fieldName)
+			}
+			if f.Default != "" {
+				meta.DefaultFields[fieldName] = f.Default
+			}
+			if n, err := strconv.ParseInt(tag.Opts["history"], 10, 64); err == nil && n > 0 {
+				meta.HistorySize = n
+			}
 		}
-		if strings.Contains(redisTag, "index_enc") {
+		if tag.has("index_enc") {
 			meta.EncIndexedFields = append(meta.EncIndexedFields, fieldName)
-		} else if strings.Contains(redisTag, "index") {
+		}
+		if tag.has("index") {
 			meta.IndexedFields = append(meta.IndexedFields, fieldName)
 		}
-		if strings.Contains(redisTag, "unique") {
+		if tag.has("unique_enc") {
+			meta.EncUniqueFields = append(meta.EncUniqueFields, fieldName)
+		}
+		if tag.has("unique") {
 			meta.UniqueFields = append(meta.UniqueFields, fieldName)
 		}
-		if strings.Contains(redisTag, "auto_create_time") {
-			meta.AutoCreateTimeFields = append(meta.AutoCreateTimeFields, fieldName)
+		if tag.has("range") || tag.has("sortable") {
+			meta.RangeFields = append(meta.RangeFields, fieldName)
 		}
-		if strings.Contains(redisTag, "auto_update_time") {
-			meta.AutoUpdateTimeFields = append(meta.AutoUpdateTimeFields, fieldName)
+		if tag.has("sortable") {
+			meta.SortField = fieldName
 		}
+	}
 
-		if f.Tag.Get("secret") == "true" {
-			meta.SecretFields = append(meta.SecretFields, fieldName)
-		}
-		if defaultTag := f.Tag.Get("default"); defaultTag != "" {
-			meta.DefaultFields[fieldName] = defaultTag
-		}
+	if len(meta.PKFields) == 0 && idField != "" {
+		meta.PKFields = []string{idField}
 	}
 
 	c.metaCache.Store(rt, meta)
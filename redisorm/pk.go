@@ -0,0 +1,143 @@
+package redisorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// pkSeparator اجزای کلید اصلی ترکیبی را در شناسه رکورد از هم جدا می‌کند.
+const pkSeparator = "|"
+
+var (
+	pkEscaper   = strings.NewReplacer("%", "%25", pkSeparator, "%7C")
+	pkUnescaper = strings.NewReplacer("%7C", pkSeparator, "%25", "%")
+)
+
+// Key مقادیر کلید اصلی ترکیبی به ترتیب تعریف فیلدهای pk در مدل است و می‌تواند به جای
+// شناسه رشته‌ای به Load، Delete و Exists داده شود:
+//
+//	orm.Load(ctx, &order, redisorm.Key{"tenant-1", 42})
+type Key []any
+
+// JoinID شناسه رکورد را از اجزای کلید اصلی ترکیبی می‌سازد. اجزا با "|" به هم متصل می‌شوند
+// و "|" و "%" درون آن‌ها escape می‌شوند؛ کلید تک‌جزئی بدون تغییر برگردانده می‌شود.
+func JoinID(parts ...any) string {
+	strs := make([]string, len(parts))
+	for i, p := range parts {
+		strs[i] = fmt.Sprint(p)
+	}
+	return joinID(strs)
+}
+
+// SplitID شناسه ساخته‌شده با JoinID را به اجزای آن تجزیه می‌کند.
+func SplitID(id string) []string {
+	parts := strings.Split(id, pkSeparator)
+	for i, p := range parts {
+		parts[i] = pkUnescaper.Replace(p)
+	}
+	return parts
+}
+
+func joinID(parts []string) string {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = pkEscaper.Replace(p)
+	}
+	return strings.Join(escaped, pkSeparator)
+}
+
+// pkPartMissing گزارش می‌دهد که آیا جزء کلید اصلی مقدار ندارد. در کلید تک‌جزئی مقدار صفر (مثلاً 0)
+// یعنی کلید تعیین نشده است، اما در کلید ترکیبی 0 مقدار معتبری است و فقط رشته خالی یا nil جزء
+// ناموجود حساب می‌شود.
+func pkPartMissing(v reflect.Value, composite bool) bool {
+	if !composite {
+		return isZero(v)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// pkFromValue شناسه رکورد را از فیلدهای pk یک مقدار struct می‌سازد. اگر هر یک از اجزا
+// مقدار نداشته باشد (pkPartMissing) رشته خالی برگردانده می‌شود.
+func pkFromValue(rv reflect.Value, meta *ModelMetadata) (string, error) {
+	if len(meta.PKFields) == 0 {
+		return "", errors.New("no pk field")
+	}
+	parts := make([]string, 0, len(meta.PKFields))
+	for _, name := range meta.PKFields {
+		fv := rv.FieldByName(name)
+		if !fv.IsValid() {
+			return "", errors.New("pk field is not valid")
+		}
+		if pkPartMissing(fv, len(meta.PKFields) > 1) {
+			return "", nil
+		}
+		parts = append(parts, fmt.Sprint(fv.Interface()))
+	}
+	return joinID(parts), nil
+}
+
+// resolveID شناسه رکورد را از یک شناسه رشته‌ای، یک Key (یا []any) به ترتیب فیلدهای pk،
+// یک struct (یا اشاره‌گر به struct) مدل با فیلدهای pk پرشده یا مقدار کلید اصلی تک‌جزئی برمی‌گرداند.
+func resolveID(meta *ModelMetadata, id any) (string, error) {
+	switch k := id.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return k, nil
+	case Key:
+		return keyID(meta, k)
+	case []any:
+		return keyID(meta, k)
+	}
+	rv := reflect.ValueOf(id)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "", nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Struct {
+		return pkFromValue(rv, meta)
+	}
+	if len(meta.PKFields) != 1 {
+		return "", fmt.Errorf("%s has a composite primary key %v; use Key or the struct", meta.StructName, meta.PKFields)
+	}
+	if isZero(rv) {
+		return "", nil
+	}
+	return fmt.Sprint(id), nil
+}
+
+func keyID(meta *ModelMetadata, key Key) (string, error) {
+	if len(key) != len(meta.PKFields) {
+		return "", fmt.Errorf("%s primary key has %d parts %v, got %d", meta.StructName, len(meta.PKFields), meta.PKFields, len(key))
+	}
+	parts := make([]string, len(key))
+	for i, p := range key {
+		if p == nil || pkPartMissing(reflect.ValueOf(p), len(key) > 1) {
+			return "", fmt.Errorf("primary key part %s is empty", meta.PKFields[i])
+		}
+		parts[i] = fmt.Sprint(p)
+	}
+	return joinID(parts), nil
+}
+
+// recordID شناسه رکورد را برای Load، Delete و Exists تعیین می‌کند؛ اگر id خالی باشد،
+// کلید اصلی از فیلدهای pk خود v خوانده می‌شود.
+func recordID(meta *ModelMetadata, v, id any) (string, error) {
+	if id == nil || id == "" {
+		id = v
+	}
+	return resolveID(meta, id)
+}
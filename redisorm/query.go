@@ -0,0 +1,281 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// عملگرهای ترکیب شرط‌ها؛ هر کاراکتر مستقیماً به اسکریپت luaQuery ارسال می‌شود.
+const (
+	queryAnd = 'A'
+	queryOr  = 'O'
+	queryNot = 'N'
+)
+
+// SortOrder جهت مرتب‌سازی نتایج بر اساس فیلد sortable مدل است.
+type SortOrder string
+
+const (
+	Asc  SortOrder = "asc"
+	Desc SortOrder = "desc"
+)
+
+type queryCond struct {
+	op    byte
+	field string
+	value string
+}
+
+// queryPage تنظیمات صفحه‌بندی یک پرس‌وجو است.
+type queryPage struct {
+	offset int64
+	limit  int64
+	order  SortOrder
+	after  string
+}
+
+// Query یک پرس‌وجو روی ایندکس‌های یک مدل است که سمت سرور با SINTER/SUNION/SDIFF ارزیابی می‌شود.
+// شرط‌ها به ترتیب و از چپ به راست اعمال می‌شوند؛ یعنی
+// Where(a).And(b).Or(c).Not(d) معادل ((a ∩ b) ∪ c) − d است.
+type Query[T any] struct {
+	r     *Repo[T]
+	conds []queryCond
+	page  queryPage
+}
+
+// Where یک پرس‌وجوی جدید با شرط برابری روی یک فیلد ایندکس‌شده (index یا index_enc) می‌سازد.
+func (r *Repo[T]) Where(field, value string) *Query[T] {
+	return &Query[T]{
+		r:     r,
+		conds: []queryCond{{op: queryOr, field: field, value: value}},
+		page:  queryPage{limit: -1},
+	}
+}
+
+// And نتیجه فعلی را با مجموعه شرط داده‌شده اشتراک می‌دهد.
+func (q *Query[T]) And(field, value string) *Query[T] {
+	q.conds = append(q.conds, queryCond{op: queryAnd, field: field, value: value})
+	return q
+}
+
+// Or نتیجه فعلی را با مجموعه شرط داده‌شده اجتماع می‌دهد.
+func (q *Query[T]) Or(field, value string) *Query[T] {
+	q.conds = append(q.conds, queryCond{op: queryOr, field: field, value: value})
+	return q
+}
+
+// Not اعضای مجموعه شرط داده‌شده را از نتیجه فعلی حذف می‌کند.
+func (q *Query[T]) Not(field, value string) *Query[T] {
+	q.conds = append(q.conds, queryCond{op: queryNot, field: field, value: value})
+	return q
+}
+
+// Limit حداکثر تعداد نتایج را تعیین می‌کند (مقدار منفی یعنی بدون محدودیت).
+func (q *Query[T]) Limit(n int64) *Query[T] {
+	q.page.limit = n
+	return q
+}
+
+// Offset تعداد نتایجی را که باید از ابتدا رد شوند تعیین می‌کند.
+func (q *Query[T]) Offset(n int64) *Query[T] {
+	q.page.offset = n
+	return q
+}
+
+// OrderBy نتایج را بر اساس فیلد sortable مدل مرتب می‌کند.
+// رکوردهایی که فیلد sortable آن‌ها مقدار ندارد در نتیجه ظاهر نمی‌شوند.
+func (q *Query[T]) OrderBy(order SortOrder) *Query[T] {
+	q.page.order = order
+	return q
+}
+
+// After پیمایش را دقیقاً پس از توکن صفحه قبلی ادامه می‌دهد (فقط همراه با OrderBy و بدون Offset).
+func (q *Query[T]) After(token string) *Query[T] {
+	q.page.after = token
+	return q
+}
+
+// IDs شناسه‌های نتیجه را با اعمال offset/limit برمی‌گرداند.
+// بدون OrderBy نتایج به ترتیب الفبایی شناسه‌ها هستند.
+func (q *Query[T]) IDs(ctx context.Context) ([]string, error) {
+	if q.page.limit == 0 {
+		return []string{}, nil
+	}
+	_, ids, _, err := q.r.c.runQuery(ctx, q.r.meta, q.conds, q.page)
+	return ids, err
+}
+
+// Count تعداد کل نتایج را بدون در نظر گرفتن offset/limit برمی‌گرداند.
+func (q *Query[T]) Count(ctx context.Context) (int64, error) {
+	page := q.page
+	page.limit = 0
+	total, _, _, err := q.r.c.runQuery(ctx, q.r.meta, q.conds, page)
+	return total, err
+}
+
+// Find نتایج را به صورت اشیاء کامل (رمزگشایی‌شده) برمی‌گرداند.
+func (q *Query[T]) Find(ctx context.Context) ([]*T, error) {
+	ids, err := q.IDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return q.r.hydrate(ctx, ids)
+}
+
+// Page یک صفحه مرتب‌شده از نتایج و توکن صفحه بعد را برمی‌گرداند.
+// توکن خالی یعنی صفحه دیگری وجود ندارد.
+func (q *Query[T]) Page(ctx context.Context) ([]*T, string, error) {
+	if q.page.order == "" {
+		return nil, "", errors.New("page requires OrderBy")
+	}
+	_, ids, next, err := q.r.c.runQuery(ctx, q.r.meta, q.conds, q.page)
+	if err != nil {
+		return nil, "", err
+	}
+	items, err := q.r.hydrate(ctx, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, next, nil
+}
+
+// runQuery یک پرس‌وجو را با اسکریپت luaQuery اجرا می‌کند و در حالت مرتب،
+// توکن صفحه بعد را نیز برمی‌گرداند.
+func (c *Client) runQuery(ctx context.Context, meta *ModelMetadata, conds []queryCond, page queryPage) (int64, []string, string, error) {
+	if len(conds) == 0 {
+		return 0, nil, "", errors.New("empty query")
+	}
+	if page.offset < 0 {
+		return 0, nil, "", errors.New("offset must be >= 0")
+	}
+	if page.order != "" && page.order != Asc && page.order != Desc {
+		return 0, nil, "", fmt.Errorf("invalid sort order %q", page.order)
+	}
+	if page.order == "" && page.after != "" {
+		return 0, nil, "", errors.New("cursor token requires an ordered query")
+	}
+	if page.offset > 0 && page.after != "" {
+		return 0, nil, "", errors.New("offset cannot be combined with a cursor token")
+	}
+	if page.order != "" && meta.SortField == "" {
+		return 0, nil, "", fmt.Errorf("model %s has no sortable field", meta.StructName)
+	}
+	modelPrefix := c.modelPrefix(meta)
+
+	token, err := randBytes(8)
+	if err != nil {
+		return 0, nil, "", err
+	}
+	keys := make([]string, 0, 2+len(conds))
+	keys = append(keys, c.keyTmp(modelPrefix, hex.EncodeToString(token)))
+	var ops strings.Builder
+	for i, cond := range conds {
+		key, err := c.conditionKey(meta, modelPrefix, TenantFrom(ctx), cond.field, cond.value)
+		if err != nil {
+			return 0, nil, "", err
+		}
+		keys = append(keys, key)
+		if i > 0 {
+			ops.WriteByte(cond.op)
+		}
+	}
+	var curScore, curID string
+	if page.order != "" {
+		keys = append(keys, c.keyRange(modelPrefix, meta.SortField))
+		if page.after != "" {
+			if curScore, curID, err = decodeCursor(page.after); err != nil {
+				return 0, nil, "", err
+			}
+		}
+	}
+
+	res, err := c.luaQuery.Run(ctx, c.rdb, keys, ops.String(), page.offset, page.limit, string(page.order), curScore, curID).Slice()
+	if err != nil {
+		return 0, nil, "", err
+	}
+	if len(res) != 2 {
+		return 0, nil, "", fmt.Errorf("unexpected query reply: %v", res)
+	}
+	total, _ := res[0].(int64)
+	raw, _ := res[1].([]interface{})
+	if page.order == "" {
+		ids := make([]string, 0, len(raw))
+		for _, v := range raw {
+			if s, ok := v.(string); ok {
+				ids = append(ids, s)
+			}
+		}
+		return total, ids, "", nil
+	}
+
+	ids := make([]string, 0, len(raw)/2)
+	var lastScore string
+	for i := 0; i+1 < len(raw); i += 2 {
+		id, _ := raw[i].(string)
+		lastScore, _ = raw[i+1].(string)
+		ids = append(ids, id)
+	}
+	var next string
+	if page.limit > 0 && int64(len(ids)) == page.limit {
+		next = encodeCursor(lastScore, ids[len(ids)-1])
+	}
+	return total, ids, next, nil
+}
+
+// conditionKey کلید مجموعه ایندکس مربوط به یک شرط برابری را می‌سازد.
+// برای فیلدهای index_enc مقدار ساده ابتدا به HMAC تبدیل می‌شود. فیلدی که index یا index_enc
+// نباشد خطا دارد، چون کلید آن هرگز وجود ندارد و نتیجه همیشه خالی می‌ماند.
+func (c *Client) conditionKey(meta *ModelMetadata, modelPrefix, tenant, field, value string) (string, error) {
+	switch {
+	case slices.Contains(meta.EncIndexedFields, field):
+		return c.keyIdxEnc(modelPrefix, field, c.blindIndex(meta, tenant, value)), nil
+	case slices.Contains(meta.IndexedFields, field):
+		return c.keyIdx(modelPrefix, field, value), nil
+	case slices.Contains(meta.RangeFields, field):
+		return "", fmt.Errorf("field %s of %s is a range field; use FindRange for it", field, meta.StructName)
+	}
+	return "", fmt.Errorf("field %s of %s is not index or index_enc", field, meta.StructName)
+}
+
+// توکن صفحه‌بندی شامل امتیاز و شناسه آخرین رکورد صفحه است تا پیمایش
+// حتی با وجود امتیازهای تکراری پایدار بماند.
+func encodeCursor(score, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(score + "\x00" + id))
+}
+
+func decodeCursor(token string) (string, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid cursor token: %w", err)
+	}
+	score, id, ok := strings.Cut(string(raw), "\x00")
+	if !ok || score == "" || id == "" {
+		return "", "", errors.New("invalid cursor token")
+	}
+	return score, id, nil
+}
+
+// PageIDsByIndexSorted مانند PageIDsByIndex است اما شناسه‌ها را بر اساس فیلد sortable مدل
+// مرتب می‌کند و به جای cursor خام SSCAN یک توکن پایدار برای صفحه بعد برمی‌گرداند.
+func (c *Client) PageIDsByIndexSorted(ctx context.Context, sample any, field, value string, order SortOrder, token string, count int64) ([]string, string, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return nil, "", err
+	}
+	if count <= 0 {
+		return nil, "", errors.New("count must be > 0")
+	}
+	conds := []queryCond{{op: queryOr, field: field, value: value}}
+	_, ids, next, err := c.runQuery(ctx, meta, conds, queryPage{limit: count, order: order, after: token})
+	return ids, next, err
+}
+
+// PageIDsByIndexSorted شناسه‌های یک ایندکس را مرتب و با توکن صفحه‌بندی برمی‌گرداند.
+func (s *Session) PageIDsByIndexSorted(sample any, field, value string, order SortOrder, token string, count int64) ([]string, string, error) {
+	return s.c.PageIDsByIndexSorted(s.ctx, sample, field, value, order, token, count)
+}
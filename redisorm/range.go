@@ -0,0 +1,77 @@
+package redisorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func formatScore(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+// rangeBound یک کران بازه را به قالب ZRANGEBYSCORE تبدیل می‌کند.
+// nil یعنی بدون کران؛ time.Time به میلی‌ثانیه یونیکس تبدیل می‌شود.
+func rangeBound(v any, inf string) (string, error) {
+	if v == nil {
+		return inf, nil
+	}
+	if s, ok := v.(string); ok {
+		// اجازه استفاده مستقیم از قالب Redis مانند "(100" یا "+inf"
+		return s, nil
+	}
+	score, ok := rangeScore(reflect.ValueOf(v))
+	if !ok {
+		return "", fmt.Errorf("unsupported range bound type %T", v)
+	}
+	return formatScore(score), nil
+}
+
+// PageIDsByRange شناسه‌هایی را که مقدار فیلد range آن‌ها بین min و max (شامل) است،
+// به ترتیب صعودی برمی‌گرداند. count منفی یعنی بدون محدودیت و count صفر یک نتیجه خالی برمی‌گرداند.
+func (c *Client) PageIDsByRange(ctx context.Context, sample any, field string, min, max any, offset, count int64) ([]string, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return nil, err
+	}
+	return c.pageIDsByRange(ctx, meta, field, min, max, offset, count)
+}
+
+func (c *Client) pageIDsByRange(ctx context.Context, meta *ModelMetadata, field string, min, max any, offset, count int64) ([]string, error) {
+	if !slices.Contains(meta.RangeFields, field) {
+		return nil, fmt.Errorf("field %s is not a range index", field)
+	}
+	lo, err := rangeBound(min, "-inf")
+	if err != nil {
+		return nil, err
+	}
+	hi, err := rangeBound(max, "+inf")
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return []string{}, nil
+	}
+	key := c.keyRange(c.modelPrefix(meta), field)
+	return c.rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: lo, Max: hi, Offset: offset, Count: count}).Result()
+}
+
+// PageIDsByRange شناسه‌ها را بر اساس بازه مقدار یک فیلد range برمی‌گرداند.
+func (s *Session) PageIDsByRange(sample any, field string, min, max any, offset, count int64) ([]string, error) {
+	return s.c.PageIDsByRange(s.ctx, sample, field, min, max, offset, count)
+}
+
+// FindRange اشیائی را که مقدار فیلد range آن‌ها بین min و max است برمی‌گرداند.
+// کران‌ها می‌توانند عدد، time.Time یا nil (بدون کران) باشند.
+func (r *Repo[T]) FindRange(ctx context.Context, field string, min, max any, limit int64) ([]*T, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	ids, err := r.c.pageIDsByRange(ctx, r.meta, field, min, max, 0, limit)
+	if err != nil {
+		return nil, err
+	}
+	return r.hydrate(ctx, ids)
+}
@@ -0,0 +1,244 @@
+package redisorm
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// گزینه‌ها و نام‌های مجاز تگ redis.
+var (
+	knownTagNames   = map[string]bool{"": true, "pk": true, "version": true, "-": true}
+	knownTagOptions = map[string]bool{
+		"index": true, "index_enc": true, "unique": true, "unique_enc": true,
+		"range": true, "sortable": true, "auto_create_time": true, "auto_update_time": true,
+		"history": true,
+	}
+	// valueTagOptions گزینه‌هایی هستند که یک مقدار عددی مثبت می‌گیرند (مانند history=10).
+	valueTagOptions = map[string]bool{"history": true}
+)
+
+// SchemaError همه مشکلات یافت‌شده هنگام اعتبارسنجی مدل‌ها در Register را نگه می‌دارد.
+type SchemaError struct {
+	Problems []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("invalid model schema (%d problems):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// Register مدل‌ها را هنگام راه‌اندازی سرویس اعتبارسنجی و ثبت می‌کند. همه مشکلات (نبود یا نوع
+// نامعتبر اجزای کلید اصلی، فیلد version غیر int64، گزینه‌های ناشناخته یا متناقض تگ، فیلدهای secret
+// که مقدار ساده را در نام کلیدها قرار می‌دهند و پیشوند تکراری یا هم‌پوشان مدل‌ها، مانند مدل User و
+// مدل Profile در گروه User) در یک *SchemaError
+// برگردانده می‌شوند. در صورت خطا هیچ مدلی ثبت نمی‌شود.
+func (c *Client) Register(models ...any) error {
+	c.regMu.Lock()
+	defer c.regMu.Unlock()
+
+	var problems []string
+	pending := map[string]reflect.Type{}
+	for _, m := range models {
+		if m == nil {
+			problems = append(problems, "nil model")
+			continue
+		}
+		rt := reflect.TypeOf(m)
+		for rt.Kind() == reflect.Pointer {
+			rt = rt.Elem()
+		}
+		if rt.Kind() != reflect.Struct {
+			problems = append(problems, fmt.Sprintf("%s: model must be a struct", rt))
+			continue
+		}
+		meta, err := c.getModelMetadata(m)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", rt.Name(), err))
+			continue
+		}
+		problems = append(problems, validateModel(meta)...)
+
+		// الگوی SCAN یک مدل (مثلاً ns:val:User:*) کلیدهای مدلی را که گروه آن همان نام است
+		// (ns:val:User:Profile:...) هم در بر می‌گیرد؛ بنابراین چنین هم‌پوشانی‌ای پذیرفته نمی‌شود.
+		prefix := c.modelName(meta)
+		for _, seen := range []map[string]reflect.Type{c.registered, pending} {
+			if other, ok := seen[prefix]; ok && other != rt {
+				problems = append(problems, fmt.Sprintf("%s: model prefix %q is already used by %s", rt, prefix, other))
+			}
+			for name, other := range seen {
+				if strings.HasPrefix(name, prefix+":") || strings.HasPrefix(prefix, name+":") {
+					problems = append(problems, fmt.Sprintf("%s: model prefix %q overlaps %q of %s", rt.Name(), prefix, name, other))
+				}
+			}
+		}
+		pending[prefix] = rt
+	}
+	if len(problems) > 0 {
+		return &SchemaError{Problems: problems}
+	}
+
+	if c.registered == nil {
+		c.registered = map[string]reflect.Type{}
+	}
+	for prefix, rt := range pending {
+		c.registered[prefix] = rt
+	}
+	return nil
+}
+
+// validateModel مشکلات طرح یک مدل را برمی‌گرداند.
+func validateModel(meta *ModelMetadata) []string {
+	var problems []string
+	report := func(field, format string, args ...any) {
+		where := meta.StructName
+		if field != "" {
+			where += "." + field
+		}
+		problems = append(problems, where+": "+fmt.Sprintf(format, args...))
+	}
+
+	sortable, history := 0, 0
+	for _, f := range meta.fields {
+		if !knownTagNames[f.Tag.Name] {
+			report(f.Name, "unknown redis tag name %q", f.Tag.Name)
+		}
+		opts := map[string]bool{}
+		for o, val := range f.Tag.Opts {
+			switch {
+			case !knownTagOptions[o]:
+				report(f.Name, "unknown redis tag option %q", o)
+			case valueTagOptions[o]:
+				if n, err := strconv.ParseInt(val, 10, 64); err != nil || n <= 0 {
+					report(f.Name, "redis tag option %q requires a positive number, got %q", o, val)
+				} else {
+					opts[o] = true
+				}
+			case val != "":
+				report(f.Name, "redis tag option %q does not take a value", o)
+			default:
+				opts[o] = true
+			}
+		}
+		secret := false
+		if f.HasSecret {
+			switch f.Secret {
+			case "true":
+				secret = true
+			case "false":
+			default:
+				report(f.Name, "secret tag must be \"true\" or \"false\", got %q", f.Secret)
+			}
+		}
+		if meta.JsonNames[f.Name] == tenantField {
+			report(f.Name, "JSON name %q is reserved for the record tenant", tenantField)
+		}
+		if f.Nested {
+			if f.Tag.Name == "pk" || f.Tag.Name == "version" || opts["auto_create_time"] || opts["auto_update_time"] || opts["history"] {
+				report(f.Name, "pk, version, history and auto time fields must be top-level or embedded")
+			}
+			if f.HasSecret {
+				report(f.Name, "secret is not supported on nested fields; mark the parent field secret")
+			}
+		}
+
+		switch f.Default {
+		case idULID:
+			if f.Type.Kind() != reflect.String {
+				report(f.Name, "default:\"ulid\" requires a string field, got %s", f.Type)
+			}
+		case idSnowflake:
+			if k := f.Type.Kind(); k != reflect.String && k != reflect.Int64 && k != reflect.Uint64 && k != reflect.Int && k != reflect.Uint {
+				report(f.Name, "default:\"snowflake\" requires a string or 64-bit integer field, got %s", f.Type)
+			}
+		case idSeq:
+			if !isPKType(f.Type) {
+				report(f.Name, "default:\"seq\" requires a string or integer field, got %s", f.Type)
+			}
+		}
+
+		if opts["index"] && opts["index_enc"] {
+			report(f.Name, "index and index_enc are mutually exclusive")
+		}
+		if opts["unique"] && opts["unique_enc"] {
+			report(f.Name, "unique and unique_enc are mutually exclusive")
+		}
+		if secret {
+			if opts["index"] {
+				report(f.Name, "secret field with index leaks plaintext into key names; use index_enc")
+			}
+			if opts["unique"] {
+				report(f.Name, "secret field with unique leaks plaintext into key names; use unique_enc")
+			}
+			if opts["range"] || opts["sortable"] {
+				report(f.Name, "secret field cannot be range or sortable (scores are stored in plaintext)")
+			}
+			if slices.Contains(meta.PKFields, f.Name) {
+				report(f.Name, "primary key cannot be secret (it is part of every key name)")
+			}
+		}
+		if opts["sortable"] {
+			sortable++
+		}
+		if opts["history"] {
+			history++
+		}
+		if (opts["range"] || opts["sortable"]) && !isScoreType(f.Type) {
+			report(f.Name, "range/sortable requires a numeric or time.Time field, got %s", f.Type)
+		}
+		if (opts["auto_create_time"] || opts["auto_update_time"]) && f.Type != reflect.TypeOf(time.Time{}) {
+			report(f.Name, "auto_create_time/auto_update_time requires a time.Time field, got %s", f.Type)
+		}
+	}
+	if sortable > 1 {
+		report("", "only one sortable field is allowed, got %d", sortable)
+	}
+	if history > 1 {
+		report("", "history may be set on one field only, got %d", history)
+	}
+
+	if len(meta.PKFields) == 0 {
+		report("", "no pk field (tag `redis:\"pk\"` or field ID)")
+	}
+	for _, name := range meta.PKFields {
+		if t := meta.FieldTypes[name]; !isPKType(t) {
+			report(name, "primary key must be a string or integer, got %s", t)
+		}
+	}
+
+	if len(meta.VersionFields) > 1 {
+		report("", "multiple version fields %v", meta.VersionFields)
+	}
+	for _, name := range meta.VersionFields {
+		if t := meta.FieldTypes[name]; t.Kind() != reflect.Int64 {
+			report(name, "version field must be int64, got %s", t)
+		}
+	}
+	return problems
+}
+
+func isPKType(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// isScoreType گزارش می‌دهد که آیا rangeScore می‌تواند برای این نوع امتیاز بسازد.
+func isScoreType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == reflect.TypeOf(time.Time{})
+}
@@ -0,0 +1,177 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Repo یک لایه نوع‌امن روی Client برای کار با یک مدل مشخص است.
+// متادیتای مدل تنها یک بار و هنگام ساخت Repo محاسبه می‌شود.
+type Repo[T any] struct {
+	c    *Client
+	meta *ModelMetadata
+	rt   reflect.Type
+}
+
+// NewRepo یک Repo برای نوع T می‌سازد. T باید یک struct باشد.
+func NewRepo[T any](c *Client) (*Repo[T], error) {
+	if c == nil {
+		return nil, errors.New("nil client")
+	}
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("repo type %s must be a struct", rt)
+	}
+	meta, err := c.getModelMetadata(new(T))
+	if err != nil {
+		return nil, err
+	}
+	return &Repo[T]{c: c, meta: meta, rt: rt}, nil
+}
+
+// Client کلاینت زیرین Repo را برمی‌گرداند.
+func (r *Repo[T]) Client() *Client { return r.c }
+
+// Save شیء را ذخیره می‌کند و کلید اصلی آن را برمی‌گرداند.
+func (r *Repo[T]) Save(ctx context.Context, v *T, ttl ...time.Duration) (string, error) {
+	if v == nil {
+		return "", errors.New("nil value")
+	}
+	return r.c.save(ctx, r.meta, v, ttl...)
+}
+
+// SaveOptimistic شیء را با قفل خوش‌بینانه (بر اساس فیلد Version) ذخیره می‌کند.
+func (r *Repo[T]) SaveOptimistic(ctx context.Context, v *T, ttl ...time.Duration) (string, error) {
+	if v == nil {
+		return "", errors.New("nil value")
+	}
+	return r.c.saveOptimistic(ctx, r.meta, v, ttl...)
+}
+
+// Load شیء را بر اساس کلید اصلی می‌خواند. id می‌تواند شناسه رشته‌ای، Key یا یک T با فیلدهای pk پرشده باشد.
+func (r *Repo[T]) Load(ctx context.Context, id any) (*T, error) {
+	key, err := resolveID(r.meta, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("empty pk for Load")
+	}
+	v := new(T)
+	if err := r.c.load(ctx, r.meta, v, key, r.c.strictDecrypt); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Delete شیء را بر اساس کلید اصلی حذف می‌کند.
+func (r *Repo[T]) Delete(ctx context.Context, id any) error {
+	key, err := resolveID(r.meta, id)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("empty pk for Delete")
+	}
+	return r.c.delete(ctx, r.meta, new(T), key)
+}
+
+// Exists بررسی می‌کند که آیا شیء با کلید اصلی مشخص شده وجود دارد یا خیر.
+func (r *Repo[T]) Exists(ctx context.Context, id any) (bool, error) {
+	key, err := resolveID(r.meta, id)
+	if err != nil {
+		return false, err
+	}
+	if key == "" {
+		return false, errors.New("empty id")
+	}
+	return r.c.exists(ctx, r.meta, key)
+}
+
+// FindByIndex یک صفحه از اشیاء دارای مقدار مشخص در فیلد index یا index_enc را برمی‌گرداند؛ برای
+// index_enc مقدار ساده داده می‌شود و با زیرکلید blind index tenant ctx به HMAC تبدیل می‌شود.
+// cursor بعدی برای ادامه پیمایش برگردانده می‌شود (صفر یعنی پایان).
+func (r *Repo[T]) FindByIndex(ctx context.Context, field, value string, cursor uint64, count int64) ([]*T, uint64, error) {
+	key, err := r.c.conditionKey(r.meta, r.c.modelPrefix(r.meta), TenantFrom(ctx), field, value)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, next, err := r.c.rdb.SScan(ctx, key, cursor, "", count).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	items, err := r.hydrate(ctx, ids)
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, next, nil
+}
+
+// FindByUniqueEnc شیء دارای مقدار ساده داده‌شده در فیلد unique_enc را برمی‌گرداند؛
+// در صورت نبود، redis.Nil برگردانده می‌شود.
+func (r *Repo[T]) FindByUniqueEnc(ctx context.Context, field, value string) (*T, error) {
+	id, err := r.c.findByUniqueEnc(ctx, r.meta, field, value)
+	if err != nil {
+		return nil, err
+	}
+	return r.Load(ctx, id)
+}
+
+// Update شیء را می‌خواند، تغییرات را بر اساس نام JSON اعمال و دوباره ذخیره می‌کند؛ id مانند Load
+// تعیین می‌شود. اگر رمزگشایی یک فیلد محرمانه شکست بخورد *DecryptError برگردانده می‌شود.
+func (r *Repo[T]) Update(ctx context.Context, id any, updates map[string]any) (*T, error) {
+	key, err := resolveID(r.meta, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("empty id")
+	}
+	v := new(T)
+	if err := r.c.load(ctx, r.meta, v, key, true); err != nil {
+		return nil, err
+	}
+	applyUpdatesByJSONName(v, updates)
+	if _, err := r.c.save(ctx, r.meta, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Transaction الگوی Get-Lock-Do را با یک تابع نوع‌امن اجرا می‌کند؛ id مانند Load تعیین می‌شود.
+func (r *Repo[T]) Transaction(ctx context.Context, id any, fn func(*T) error) error {
+	key, err := resolveID(r.meta, id)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return errors.New("empty id")
+	}
+	return r.c.transaction(ctx, r.meta, r.rt, key, func(v any) error {
+		return fn(v.(*T))
+	})
+}
+
+// hydrate اشیاء را به ترتیب شناسه‌ها بارگذاری می‌کند و شناسه‌های ناموجود را نادیده می‌گیرد.
+func (r *Repo[T]) hydrate(ctx context.Context, ids []string) ([]*T, error) {
+	plains, err := r.c.loadMany(ctx, r.meta, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*T, 0, len(plains))
+	for i, plain := range plains {
+		if plain == nil {
+			continue
+		}
+		v := new(T)
+		if err := json.Unmarshal(plain, v); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", ids[i], err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,183 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// rotateRetries تعداد تلاش برای بازنویسی رکوردی است که همزمان تغییر می‌کند.
+const rotateRetries = 3
+
+// RotateKeys تمام رکوردها و payloadهای رمز‌شده یک مدل را با کلید فعال دوباره رمز می‌کند
+// و کلیدهای index_enc و unique_enc را با HMAC کلید فعال بازسازی می‌کند. تعداد رکوردهای بازنویسی‌شده
+// برگردانده می‌شود.
+//
+// این روال به صورت آنلاین و همزمان با ترافیک عادی اجرا می‌شود (معمولاً در یک goroutine
+// جداگانه)؛ هر رکورد با compare-and-set بازنویسی می‌شود تا نوشتن‌های همزمان از بین نروند و
+// ورودی‌های قبلی همان رکورد از روی shadow آن در همان اسکریپت حذف می‌شوند. تا پایان اجرا ممکن است
+// جستجو روی index_enc برخی رکوردها را پیدا نکند، اما unique_enc در این مدت با کلیدهای بازنشسته
+// هم بررسی می‌شود. ورودی‌های رکوردهای بدون shadow را Repair حذف می‌کند.
+func (c *Client) RotateKeys(ctx context.Context, sample any) (int, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return 0, err
+	}
+	modelPrefix := c.modelPrefix(meta)
+
+	rotated := 0
+	valPrefix := c.keyVal(modelPrefix, "")
+	err = c.scanKeys(ctx, c.keyPattern("val", modelPrefix), func(keys []string) error {
+		for _, key := range keys {
+			id := strings.TrimPrefix(key, valPrefix)
+			n, err := c.rotateRecord(ctx, meta, modelPrefix, key, id)
+			if err != nil {
+				return fmt.Errorf("rotate %s: %w", id, err)
+			}
+			rotated += n
+		}
+		return nil
+	})
+	if err != nil {
+		return rotated, err
+	}
+
+	plPrefix := c.keyPayload(modelPrefix, "")
+	err = c.scanKeys(ctx, c.keyPattern("pl", modelPrefix), func(keys []string) error {
+		for _, key := range keys {
+			if err := c.rotatePayload(ctx, meta, key, strings.TrimPrefix(key, plPrefix)); err != nil {
+				return fmt.Errorf("rotate payload %s: %w", key, err)
+			}
+		}
+		return nil
+	})
+	return rotated, err
+}
+
+// rotateRecord یک رکورد را دوباره رمز کرده و کلیدهای index_enc و unique_enc آن را با کلید فعال
+// جایگزین می‌کند؛ اگر رکورد بازنویسی شده باشد 1 برمی‌گرداند.
+func (c *Client) rotateRecord(ctx context.Context, meta *ModelMetadata, modelPrefix, key, id string) (int, error) {
+	for attempt := 0; attempt < rotateRetries; attempt++ {
+		enc, err := c.rdb.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		newEnc, err := c.reencryptDoc(ctx, meta, id, enc)
+		if err != nil {
+			return 0, err
+		}
+		plain, err := c.decryptStrict(ctx, meta, id, newEnc)
+		if err != nil {
+			return 0, err
+		}
+		// فقط slotهای blind index با کلید فعال تغییر می‌کنند؛ shadow رکورد هم به‌روز می‌شود.
+		var idxKeys, uniq []string
+		argv := []interface{}{enc, newEnc, id}
+		slots := c.indexSlots(meta, modelPrefix, storedTenant(meta, newEnc), plain)
+		for _, name := range slotNames(meta) {
+			if key, ok := slots[name]; ok && (strings.HasPrefix(name, "idxenc:") || strings.HasPrefix(name, "uniqenc:")) {
+				idxKeys = append(idxKeys, key)
+				argv = append(argv, name)
+				if strings.HasPrefix(name, "uniqenc:") {
+					uniq = append(uniq, key)
+				}
+			}
+		}
+		current, err := c.currentKeys(ctx, modelPrefix, id, uniq)
+		if err != nil {
+			return 0, err
+		}
+		keys := append([]string{key, c.keyShadow(modelPrefix, id)}, idxKeys...)
+		ok, err := c.luaRotate.Run(ctx, c.rdb, append(keys, current...), argv...).Int()
+		if isStaleKeys(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if ok == 1 {
+			if newEnc != enc {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, errors.New("record keeps changing during rotation")
+}
+
+// reencryptDoc فیلدهای محرمانه‌ای را که با کلید فعال رمز نشده‌اند دوباره رمز می‌کند.
+// اگر تغییری لازم نباشد همان مقدار ورودی برگردانده می‌شود.
+func (c *Client) reencryptDoc(ctx context.Context, meta *ModelMetadata, id, encJSON string) (string, error) {
+	if len(meta.SecretFields) == 0 {
+		return encJSON, nil
+	}
+	m, err := decodeDoc(encJSON)
+	if err != nil {
+		return "", err
+	}
+	changed := false
+	opener, sealer := c.newOpener(ctx, "val", meta, id), c.newSealer(ctx, "val", meta, id, recordTenant(meta, m))
+	for _, fieldName := range meta.SecretFields {
+		jsonName := meta.JsonNames[fieldName]
+		s, ok := m[jsonName].(string)
+		if !ok || !isCiphertext(s) || c.isCurrentCiphertext(s) {
+			continue
+		}
+		plain, err := opener.open(jsonName, s)
+		if err != nil {
+			return "", fmt.Errorf("decrypt %s: %w", fieldName, err)
+		}
+		ct, err := sealer.seal(jsonName, plain)
+		if err != nil {
+			return "", fmt.Errorf("encrypt %s: %w", fieldName, err)
+		}
+		m[jsonName] = ct
+		changed = true
+	}
+	if !changed {
+		return encJSON, nil
+	}
+	out, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (c *Client) rotatePayload(ctx context.Context, meta *ModelMetadata, key, id string) error {
+	for attempt := 0; attempt < rotateRetries; attempt++ {
+		val, err := c.rdb.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !isCiphertext(val) || c.isCurrentCiphertext(val) {
+			return nil
+		}
+		plain, err := c.newOpener(ctx, "pl", meta, id).open(payloadField, val)
+		if err != nil {
+			return err
+		}
+		ct, err := c.newSealer(ctx, "pl", meta, id, "").seal(payloadField, plain)
+		if err != nil {
+			return err
+		}
+		ok, err := c.luaRotate.Run(ctx, c.rdb, []string{key}, val, ct, "").Int()
+		if err != nil || ok == 1 {
+			return err
+		}
+	}
+	return errors.New("payload keeps changing during rotation")
+}
+
+// RotateKeys داده‌های رمز‌شده یک مدل را با کلید فعال دوباره رمز می‌کند.
+func (s *Session) RotateKeys(sample any) (int, error) { return s.c.RotateKeys(s.ctx, sample) }
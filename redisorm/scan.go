@@ -0,0 +1,62 @@
+package redisorm
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const scanBatch = 500
+
+// scanKeys همه کلیدهای منطبق با الگو را پیمایش می‌کند. در کلاستر و Ring روی تمام
+// nodeها اجرا می‌شود؛ fn هرگز به صورت همزمان فراخوانی نمی‌شود.
+func (c *Client) scanKeys(ctx context.Context, pattern string, fn func(keys []string) error) error {
+	var mu sync.Mutex
+	scanNode := func(ctx context.Context, node redis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, pattern, scanBatch).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				mu.Lock()
+				err = fn(keys)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	switch rdb := c.rdb.(type) {
+	case *redis.ClusterClient:
+		return rdb.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node)
+		})
+	case *redis.Ring:
+		return rdb.ForEachShard(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node)
+		})
+	}
+	return scanNode(ctx, c.rdb)
+}
+
+// globEscape کاراکترهای خاص الگوی SCAN را escape می‌کند.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -8,79 +8,125 @@ import (
 	"strings"
 )
 
-// buildEncryptedMap encrypts secret fields using the master key directly.
-func (c *Client) buildEncryptedMap(ctx context.Context, v any, meta *ModelMetadata) (map[string]any, error) {
+// buildEncryptedMap encodes v the way encoding/json does (so embedded structs are
+// flattened) and replaces secret fields with ciphertexts bound to record id and
+// their JSON field name.
+func (c *Client) buildEncryptedMap(ctx context.Context, v any, meta *ModelMetadata, id string) (map[string]any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal plain: %w", err)
+	}
+	out, err := decodeDoc(string(raw))
+	if err != nil {
+		return nil, err
+	}
 	rv := reflect.ValueOf(v)
 	if rv.Kind() == reflect.Pointer {
 		rv = rv.Elem()
 	}
-	rt := rv.Type()
-	out := make(map[string]any, rt.NumField())
 
-	for i := 0; i < rt.NumField(); i++ {
-		f := rt.Field(i)
-		if f.PkgPath != "" {
+	sealer := c.newSealer(ctx, "val", meta, id, TenantFrom(ctx))
+
+	for _, fieldName := range meta.SecretFields {
+		jsonName := meta.JsonNames[fieldName]
+		if _, ok := out[jsonName]; !ok {
 			continue
 		}
-		jsonName := meta.JsonNames[f.Name]
-		if jsonName == "" || jsonName == "-" {
-			continue
+		plain, empty, err := secretPlaintext(rv.FieldByName(fieldName).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("encode secret %s: %w", fieldName, err)
 		}
-
-		val := rv.Field(i)
-		isSecret := false
-		for _, secretField := range meta.SecretFields {
-			if f.Name == secretField {
-				isSecret = true
-				break
-			}
+		if empty {
+			continue
 		}
 
-		if isSecret {
-			if val.Kind() != reflect.String {
-				return nil, fmt.Errorf("secret field %s must be string", f.Name)
-			}
-			plain := val.String()
-			if plain == "" {
-				out[jsonName] = ""
-				continue
-			}
-
-			// >>>>>>>>> SIMPLIFIED: Use master key (kek) directly <<<<<<<<<
-			ct, err := aesGCMEncrypt(c.kek, []byte(plain))
-			if err != nil {
-				return nil, fmt.Errorf("encrypt %s: %w", f.Name, err)
-			}
-			out[jsonName] = ct
-			continue
+		ct, err := sealer.seal(jsonName, plain)
+		if err != nil {
+			return nil, fmt.Errorf("encrypt %s: %w", fieldName, err)
 		}
-		out[jsonName] = toJSONNative(val)
+		out[jsonName] = ct
+	}
+	if t := TenantFrom(ctx); t != "" {
+		out[tenantField] = t
 	}
 	return out, nil
 }
 
-// decryptForType decrypts secret fields using the master key directly.
-func (c *Client) decryptForType(ctx context.Context, meta *ModelMetadata, encJSON string) ([]byte, error) {
-	var m map[string]any
-	if err := json.Unmarshal([]byte(encJSON), &m); err != nil {
-		return nil, fmt.Errorf("invalid stored JSON: %w", err)
+// DecryptError خطای رمزگشایی یک فیلد محرمانه در یک رکورد مشخص است.
+type DecryptError struct {
+	Model string
+	ID    string
+	Field string
+	Err   error
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("decrypt %s(%s).%s: %v", e.Model, e.ID, e.Field, e.Err)
+}
+
+func (e *DecryptError) Unwrap() error { return e.Err }
+
+// WithStrictDecryption باعث می‌شود Load، پرس‌وجوها و Save در صورت شکست رمزگشایی یک فیلد
+// محرمانه (ciphertext خراب یا کلید نامعتبر) خطای *DecryptError برگردانند.
+func WithStrictDecryption() Option {
+	return func(c *Client) { c.strictDecrypt = true }
+}
+
+// WithDecryptErrorHandler در حالت پیش‌فرض (غیر strict) برای هر فیلدی که رمزگشایی آن شکست
+// بخورد فراخوانی می‌شود؛ مقدار آن فیلد در خروجی صفر می‌شود. مناسب برای هشدار روی عدم تطابق کلید.
+func WithDecryptErrorHandler(fn func(*DecryptError)) Option {
+	return func(c *Client) { c.onDecryptError = fn }
+}
+
+// decryptForType decrypts secret fields with whichever key id is stamped into each ciphertext.
+// A field that fails to decrypt is returned as a *DecryptError in strict mode; otherwise it is
+// replaced with its zero value and reported to the decrypt error handler.
+func (c *Client) decryptForType(ctx context.Context, meta *ModelMetadata, id, encJSON string) ([]byte, error) {
+	return c.decryptDoc(ctx, meta, id, encJSON, c.strictDecrypt)
+}
+
+// decryptStrict is decryptForType that always fails with a *DecryptError. Paths that write the
+// decoded record back or derive index keys from it use it, so zeroed values are never stored.
+func (c *Client) decryptStrict(ctx context.Context, meta *ModelMetadata, id, encJSON string) ([]byte, error) {
+	return c.decryptDoc(ctx, meta, id, encJSON, true)
+}
+
+func (c *Client) decryptDoc(ctx context.Context, meta *ModelMetadata, id, encJSON string, strict bool) ([]byte, error) {
+	m, err := decodeDoc(encJSON)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(meta.SecretFields) == 0 {
 		return []byte(encJSON), nil
 	}
 
+	opener := c.newOpener(ctx, "val", meta, id)
 	for _, fieldName := range meta.SecretFields {
 		jsonName := meta.JsonNames[fieldName]
 		if raw, ok := m[jsonName]; ok {
-			if s, ok := raw.(string); ok && strings.HasPrefix(s, fieldEncPrefix) {
-				// >>>>>>>>> SIMPLIFIED: Use master key (kek) directly <<<<<<<<<
-				plain, err := aesGCMDecrypt(c.kek, s)
+			if s, ok := raw.(string); ok && isCiphertext(s) {
+				plain, err := opener.open(jsonName, s)
 				if err != nil {
-					// Don't fail the whole load if one field fails decryption
+					derr := &DecryptError{Model: meta.StructName, ID: id, Field: fieldName, Err: err}
+					if strict {
+						return nil, derr
+					}
+					if c.onDecryptError != nil {
+						c.onDecryptError(derr)
+					}
+					zero, err := json.Marshal(reflect.Zero(meta.FieldTypes[fieldName]).Interface())
+					if err != nil {
+						return nil, err
+					}
+					m[jsonName] = json.RawMessage(zero)
 					continue
 				}
-				m[jsonName] = string(plain)
+				if meta.FieldTypes[fieldName].Kind() == reflect.String {
+					m[jsonName] = string(plain)
+				} else {
+					m[jsonName] = json.RawMessage(plain)
+				}
 			}
 		}
 	}
@@ -93,12 +139,13 @@ func (c *Client) decryptForType(ctx context.Context, meta *ModelMetadata, encJSO
 }
 
 // encryptUpdateMap encrypts fields in an update map that are marked as secret.
-func (c *Client) encryptUpdateMap(ctx context.Context, meta *ModelMetadata, updates map[string]any) (map[string]any, error) {
+func (c *Client) encryptUpdateMap(ctx context.Context, meta *ModelMetadata, id string, updates map[string]any) (map[string]any, error) {
 	if len(meta.SecretFields) == 0 {
 		return updates, nil
 	}
 
 	encrypted := make(map[string]any, len(updates))
+	sealer := c.newSealer(ctx, "val", meta, id, TenantFrom(ctx))
 	for k, v := range updates {
 		encrypted[k] = v
 	}
@@ -113,15 +160,58 @@ func (c *Client) encryptUpdateMap(ctx context.Context, meta *ModelMetadata, upda
 		}
 
 		if isSecret {
-			if plainStr, isStr := plainVal.(string); isStr && plainStr != "" {
-				// >>>>>>>>> SIMPLIFIED: Use master key (kek) directly <<<<<<<<<
-				ct, err := aesGCMEncrypt(c.kek, []byte(plainStr))
-				if err != nil {
-					return nil, fmt.Errorf("encrypt update for %s: %w", jsonName, err)
-				}
-				encrypted[jsonName] = ct
+			plain, empty, err := secretPlaintext(plainVal)
+			if err != nil {
+				return nil, fmt.Errorf("encode update for %s: %w", jsonName, err)
+			}
+			if empty {
+				continue
 			}
+			ct, err := sealer.seal(jsonName, plain)
+			if err != nil {
+				return nil, fmt.Errorf("encrypt update for %s: %w", jsonName, err)
+			}
+			encrypted[jsonName] = ct
 		}
 	}
 	return encrypted, nil
 }
+
+// payloadField is the field name payload ciphertexts are bound to.
+const payloadField = "payload"
+
+// secretPlaintext returns the bytes to encrypt for a secret value. Strings are
+// encrypted as-is (compatible with existing ciphertexts); any other type is
+// encrypted as its JSON encoding and restored to its type on decryption.
+// Empty strings and nil values are stored unencrypted.
+func secretPlaintext(v any) (plain []byte, empty bool, err error) {
+	if v == nil {
+		return nil, true, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(rv.String()), rv.Len() == 0, nil
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		if rv.IsNil() {
+			return nil, true, nil
+		}
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+	return bs, false, nil
+}
+
+// decodeDoc parses a stored document into a map, keeping numbers as json.Number
+// so that re-encoding does not lose int64 precision.
+func decodeDoc(encJSON string) (map[string]any, error) {
+	dec := json.NewDecoder(strings.NewReader(encJSON))
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid stored JSON: %w", err)
+	}
+	return m, nil
+}
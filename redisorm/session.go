@@ -30,23 +30,58 @@ func (s *Session) SaveAll(slice any) ([]string, error) {
 }
 
 // Load یک شیء را بر اساس کلید اصلی آن از Redis می‌خواند.
-func (s *Session) Load(dst any, id string) error { return s.c.Load(s.ctx, dst, id) }
+func (s *Session) Load(dst any, id any) error { return s.c.Load(s.ctx, dst, id) }
 
 // Delete یک شیء را بر اساس کلید اصلی آن به صورت اتمی حذف می‌کند.
-func (s *Session) Delete(v any, id string) error { return s.c.Delete(s.ctx, v, id) }
+func (s *Session) Delete(v any, id any) error { return s.c.Delete(s.ctx, v, id) }
 
 // UpdateFields شیء را می‌خواند، تغییرات را اعمال می‌کند و سپس آن را دوباره ذخیره می‌کند.
 func (s *Session) UpdateFields(dst any, id string, updates map[string]any) (string, error) {
 	return s.c.UpdateFields(s.ctx, dst, id, updates)
 }
 
-// UpdateFieldsFast یک آپدیت جزئی و بسیار سریع روی JSON ذخیره شده انجام می‌دهد.
-func (s *Session) UpdateFieldsFast(sample any, id string, updates map[string]any) error {
-	return s.c.UpdateFieldsFast(s.ctx, sample, id, updates)
+// UpdateFieldsFast یک آپدیت جزئی و بسیار سریع روی JSON ذخیره شده انجام می‌دهد و نام فیلدهای تغییرکرده را برمی‌گرداند.
+func (s *Session) UpdateFieldsFast(sample any, id string, updates map[string]any, opts ...UpdateOption) ([]string, error) {
+	return s.c.UpdateFieldsFast(s.ctx, sample, id, updates, opts...)
 }
 
 // Exists بررسی می‌کند که آیا شیء با کلید اصلی مشخص شده وجود دارد یا خیر.
-func (s *Session) Exists(sample any, id string) (bool, error) { return s.c.Exists(s.ctx, sample, id) }
+func (s *Session) Exists(sample any, id any) (bool, error) { return s.c.Exists(s.ctx, sample, id) }
+
+// History نسخه‌های نگه‌داشته‌شده یک رکورد را از جدیدترین به قدیمی‌ترین برمی‌گرداند.
+func (s *Session) History(sample any, id any) ([]HistoryEntry, error) {
+	return s.c.History(s.ctx, sample, id)
+}
+
+// LoadVersion یک نسخه قدیمی رکورد را از تاریخچه آن می‌خواند.
+func (s *Session) LoadVersion(dst any, id any, version int64) error {
+	return s.c.LoadVersion(s.ctx, dst, id, version)
+}
+
+// Revert رکورد را به یکی از نسخه‌های تاریخچه آن برمی‌گرداند.
+func (s *Session) Revert(sample any, id any, version int64) error {
+	return s.c.Revert(s.ctx, sample, id, version)
+}
+
+// AuditLog سابقه تغییرات یک رکورد را از جدیدترین به قدیمی‌ترین برمی‌گرداند.
+func (s *Session) AuditLog(sample any, id any, limit int64) ([]AuditEntry, error) {
+	return s.c.AuditLog(s.ctx, sample, id, limit)
+}
+
+// AuditByActor تغییرات یک انجام‌دهنده روی رکوردهای مدل را از جدیدترین به قدیمی‌ترین برمی‌گرداند.
+func (s *Session) AuditByActor(sample any, actor string, limit int64) ([]AuditEntry, error) {
+	return s.c.AuditByActor(s.ctx, sample, actor, limit)
+}
+
+// Watch تغییرات یک رکورد را تا پایان context session روی کانال برگشتی ارسال می‌کند.
+func (s *Session) Watch(sample any, id any) (<-chan ChangeEvent, error) {
+	return s.c.Watch(s.ctx, sample, id)
+}
+
+// WatchModel تغییرات همه رکوردهای یک مدل را تا پایان context session روی کانال برگشتی ارسال می‌کند.
+func (s *Session) WatchModel(sample any) (<-chan ChangeEvent, error) {
+	return s.c.WatchModel(s.ctx, sample)
+}
 
 // >>>>>>>>> MODIFIED: امضای متد برای پشتیبانی از گروه تغییر کرد <<<<<<<<<
 // Touch زمان انقضای (TTL) یک شیء را تمدید می‌کند.
@@ -80,6 +115,11 @@ func (s *Session) PageIDsByEncIndex(sample any, field, plainValue string, cursor
 	return s.c.PageIDsByEncIndex(s.ctx, sample, field, plainValue, cursor, count)
 }
 
+// FindByUniqueEnc شناسه رکورد دارای مقدار ساده داده‌شده در فیلد unique_enc را برمی‌گرداند.
+func (s *Session) FindByUniqueEnc(sample any, field, plainValue string) (string, error) {
+	return s.c.FindByUniqueEnc(s.ctx, sample, field, plainValue)
+}
+
 func (s *Session) Edit(dst any, id string, mut func() error) (string, error) {
 	meta, err := s.c.getModelMetadata(dst)
 	if err != nil {
@@ -91,7 +131,7 @@ func (s *Session) Edit(dst any, id string, mut func() error) (string, error) {
 			return "", errors.New("empty id")
 		}
 	}
-	if err := s.c.Load(s.ctx, dst, id); err != nil && err != redis.Nil {
+	if err := s.c.load(s.ctx, meta, dst, id, true); err != nil && err != redis.Nil {
 		return "", err
 	}
 	if mut != nil {
@@ -99,7 +139,7 @@ func (s *Session) Edit(dst any, id string, mut func() error) (string, error) {
 			return "", err
 		}
 	}
-	if vp, _ := versionPointer(dst); vp != nil {
+	if vp := versionPointer(dst); vp != nil {
 		return s.c.SaveOptimistic(s.ctx, dst)
 	}
 	return s.c.Save(s.ctx, dst)
@@ -124,24 +164,28 @@ func (op *TransactionalOperation) Execute(fn func(v any) error) error {
 	if err != nil {
 		return err
 	}
+	rt := reflect.TypeOf(op.sample)
+	if rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	return op.sess.c.transaction(op.sess.ctx, meta, rt, op.id, fn)
+}
 
-	modelPrefix := op.sess.c.modelPrefix(meta)
-	unlock, err := op.sess.c.acquireLockWithRetry(op.sess.ctx, modelPrefix, op.id, 5*time.Second, LockRetry{
+// transaction الگوی Get-Lock-Do را برای یک نوع مشخص اجرا می‌کند.
+func (c *Client) transaction(ctx context.Context, meta *ModelMetadata, rt reflect.Type, id string, fn func(v any) error) error {
+	modelPrefix := c.modelPrefix(meta)
+	unlock, err := c.acquireLockWithRetry(ctx, modelPrefix, id, 5*time.Second, LockRetry{
 		Attempts: 3,
 		Backoff:  100 * time.Millisecond,
 	})
 	if err != nil {
-		return fmt.Errorf("could not acquire lock for %s: %w", op.id, err)
+		return fmt.Errorf("could not acquire lock for %s: %w", id, err)
 	}
-	defer unlock(op.sess.ctx)
+	defer unlock(ctx)
 
-	rt := reflect.TypeOf(op.sample)
-	if rt.Kind() == reflect.Pointer {
-		rt = rt.Elem()
-	}
 	obj := reflect.New(rt).Interface()
 
-	if err := op.sess.Load(obj, op.id); err != nil {
+	if err := c.load(ctx, meta, obj, id, true); err != nil {
 		return fmt.Errorf("could not load object inside lock: %w", err)
 	}
 
@@ -149,10 +193,10 @@ func (op *TransactionalOperation) Execute(fn func(v any) error) error {
 		return err
 	}
 
-	if vp, _ := versionPointer(obj); vp != nil {
-		_, err = op.sess.c.SaveOptimistic(op.sess.ctx, obj)
+	if vp := versionPointer(obj); vp != nil {
+		_, err = c.saveOptimistic(ctx, meta, obj)
 	} else {
-		_, err = op.sess.c.Save(op.sess.ctx, obj)
+		_, err = c.save(ctx, meta, obj)
 	}
 
 	if err != nil {
@@ -160,4 +204,4 @@ func (op *TransactionalOperation) Execute(fn func(v any) error) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
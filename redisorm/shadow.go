@@ -0,0 +1,220 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// shadowRetries تعداد تلاش برای ساخت shadow رکوردهای قدیمی و اجرای دوباره اسکریپت است.
+const shadowRetries = 3
+
+// keyShadow هش shadow یک رکورد است که کلیدهای index، index_enc، unique و unique_enc فعلی آن
+// را بر اساس نام slot (مانند "idx:Country") نگه می‌دارد. اسکریپت‌های Lua تفاوت کلیدهای قدیم و
+// جدید را از روی آن محاسبه می‌کنند، بنابراین نیازی به خواندن مقدار قبلی در کلاینت نیست.
+func (c *Client) keyShadow(modelPrefix, id string) string {
+	return fmt.Sprintf("%s:shd:%s:%s", c.ns, modelPrefix, id)
+}
+
+// slotNames نام همه slotهای ایندکسی یک مدل را به ترتیب ثابت برمی‌گرداند.
+func slotNames(meta *ModelMetadata) []string {
+	var names []string
+	for _, g := range []struct {
+		kind   string
+		fields []string
+	}{
+		{"idx", meta.IndexedFields},
+		{"idxenc", meta.EncIndexedFields},
+		{"uniq", meta.UniqueFields},
+		{"uniqenc", meta.EncUniqueFields},
+	} {
+		for _, f := range g.fields {
+			names = append(names, g.kind+":"+f)
+		}
+	}
+	return names
+}
+
+// indexSlots کلیدهای ایندکسی یک سند رمزگشایی‌شده را بر اساس نام slot برمی‌گرداند.
+func (c *Client) indexSlots(meta *ModelMetadata, modelPrefix, tenant string, plain []byte) map[string]string {
+	slots := map[string]string{}
+	for f, v := range extractIndexable(nil, plain, meta) {
+		slots["idx:"+f] = c.keyIdx(modelPrefix, f, v)
+	}
+	for f, mac := range extractEncIndex(c, tenant, plain, meta) {
+		slots["idxenc:"+f] = c.keyIdxEnc(modelPrefix, f, mac)
+	}
+	for f, v := range extractUnique(nil, plain, meta) {
+		slots["uniq:"+f] = c.keyUniq(modelPrefix, f, v)
+	}
+	for f, mac := range extractEncUnique(c, tenant, plain, meta) {
+		slots["uniqenc:"+f] = c.keyUniqEnc(modelPrefix, f, mac)
+	}
+	return slots
+}
+
+// slotArgs slotهای names را برای اسکریپت آماده می‌کند: کلید slotهای دارای مقدار به keys اضافه
+// می‌شود و slotهای بدون مقدار با پیشوند "-" (پاک کردن) مشخص می‌شوند.
+func slotArgs(names []string, slots map[string]string) (keys []string, specs []interface{}) {
+	for _, name := range names {
+		if key, ok := slots[name]; ok {
+			keys = append(keys, key)
+			specs = append(specs, name)
+		} else {
+			specs = append(specs, "-"+name)
+		}
+	}
+	return keys, specs
+}
+
+// uniqueGuards برای slotهای unique_enc از میان names، کلیدهای همان مقدار زیر کلیدهای blind index
+// بازنشسته را به صورت slot نگهبان ("?" در luaShadowLib) برمی‌گرداند تا تا پایان RotateKeys رکوردی
+// که هنوز کلید قبلی را دارد هم تداخل یکتایی حساب شود.
+func (c *Client) uniqueGuards(meta *ModelMetadata, modelPrefix, tenant string, plain []byte, names []string) (keys []string, specs []interface{}) {
+	if len(meta.EncUniqueFields) == 0 {
+		return nil, nil
+	}
+	var m map[string]any
+	_ = json.Unmarshal(plain, &m)
+	for _, name := range names {
+		fieldName, ok := strings.CutPrefix(name, "uniqenc:")
+		if !ok {
+			continue
+		}
+		v, ok := docValue(m, meta, fieldName)
+		if !ok {
+			continue
+		}
+		for _, mac := range c.retiredBlindIndexes(meta, tenant, fmt.Sprint(v)) {
+			keys = append(keys, c.keyUniqEnc(modelPrefix, fieldName, mac))
+			specs = append(specs, "?"+name)
+		}
+	}
+	return keys, specs
+}
+
+// uniqKeys کلید slotهای یکتا (unique و unique_enc) از میان names را برمی‌گرداند.
+func uniqKeys(names []string, slots map[string]string) []string {
+	var keys []string
+	for _, name := range names {
+		if key, ok := slots[name]; ok && strings.HasPrefix(name, "uniq") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// queueCurrentKeys خواندن کلیدهایی را که اسکریپت‌ها علاوه بر کلیدهای ثابت خود لمس می‌کنند به pipe
+// اضافه می‌کند: کلیدهای ثبت‌شده در shadow رکورد و کلید مقدار رکوردهای دیگری که اکنون مالک
+// کلیدهای یکتای uniq هستند. تابع برگشتی پس از Exec این کلیدها را برای انتهای KEYS برمی‌گرداند.
+// این کلیدها فقط در حالت کلاستر باید در KEYS اعلام شوند؛ روی یک نود چیزی خوانده نمی‌شود و
+// اسکریپت خودش آن‌ها را می‌خواند.
+func (c *Client) queueCurrentKeys(ctx context.Context, pipe redis.Pipeliner, modelPrefix, id string, uniq []string) func() []string {
+	if !c.hashTags {
+		return func() []string { return nil }
+	}
+	shadow := pipe.HGetAll(ctx, c.keyShadow(modelPrefix, id))
+	var owners *redis.SliceCmd
+	if len(uniq) > 0 {
+		owners = pipe.MGet(ctx, uniq...)
+	}
+	return func() []string {
+		var keys []string
+		for slot, key := range shadow.Val() {
+			if slot != "_" {
+				keys = append(keys, key)
+			}
+		}
+		if owners != nil {
+			for _, v := range owners.Val() {
+				if owner, ok := v.(string); ok && owner != id {
+					keys = append(keys, c.keyVal(modelPrefix, owner))
+				}
+			}
+		}
+		return keys
+	}
+}
+
+// currentKeys کلیدهای queueCurrentKeys را برای یک رکورد می‌خواند.
+func (c *Client) currentKeys(ctx context.Context, modelPrefix, id string, uniq []string) ([]string, error) {
+	if !c.hashTags {
+		return nil, nil
+	}
+	pipe := c.rdb.Pipeline()
+	collect := c.queueCurrentKeys(ctx, pipe, modelPrefix, id, uniq)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return collect(), nil
+}
+
+// shadowScript اسکریپتی را که luaShadowLib را در بر دارد می‌سازد؛ checkDeclared مشخص می‌کند
+// که آیا کلیدهای اعلام‌نشده در KEYS (حالت کلاستر) به STALE_KEYS منجر شوند.
+func shadowScript(src string, checkDeclared bool) *redis.Script {
+	return redis.NewScript(fmt.Sprintf("local checkDeclared = %t\n", checkDeclared) + src)
+}
+
+func isNoShadow(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "NO_SHADOW")
+}
+
+// isStaleKeys گزارش می‌دهد که آیا shadow یا مالک یک کلید یکتا پس از خواندن کلیدهای فعلی تغییر
+// کرده و اسکریپت بدون نوشتن برگشته است.
+func isStaleKeys(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "STALE_KEYS")
+}
+
+// withShadow اسکریپت run را با کلیدهای فعلی رکورد (currentKeys) اجرا می‌کند. اگر این کلیدها
+// همزمان تغییر کنند دوباره خوانده می‌شوند و اگر رکورد پیش از معرفی shadowها نوشته شده باشد، ابتدا
+// shadow آن از روی سند ذخیره‌شده ساخته می‌شود؛ در هر دو حالت اسکریپت دوباره اجرا می‌شود. اگر
+// تلاش‌ها تمام شوند ErrIndexKeysChanged برگردانده می‌شود.
+func (c *Client) withShadow(ctx context.Context, meta *ModelMetadata, modelPrefix, id string, uniq []string, run func(current []string) error) error {
+	for attempt := 0; attempt < shadowRetries; attempt++ {
+		current, err := c.currentKeys(ctx, modelPrefix, id, uniq)
+		if err != nil {
+			return err
+		}
+		err = run(current)
+		switch {
+		case isStaleKeys(err):
+		case isNoShadow(err):
+			if err := c.seedShadow(ctx, meta, modelPrefix, id); err != nil {
+				return fmt.Errorf("seed index shadow: %w", err)
+			}
+		default:
+			return err
+		}
+	}
+	return ErrIndexKeysChanged
+}
+
+// seedShadow کلیدهای ایندکسی رکوردی را که shadow ندارد از روی سند فعلی آن ثبت می‌کند.
+func (c *Client) seedShadow(ctx context.Context, meta *ModelMetadata, modelPrefix, id string) error {
+	valKey := c.keyVal(modelPrefix, id)
+	enc, err := c.rdb.Get(ctx, valKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	plain, err := c.decryptStrict(ctx, meta, id, enc)
+	if err != nil {
+		return err
+	}
+	slots := c.indexSlots(meta, modelPrefix, storedTenant(meta, enc), plain)
+	keys := []string{valKey, c.keyShadow(modelPrefix, id)}
+	argv := []interface{}{enc}
+	for _, name := range slotNames(meta) {
+		if key, ok := slots[name]; ok {
+			keys = append(keys, key)
+			argv = append(argv, name)
+		}
+	}
+	return c.luaSeedShadow.Run(ctx, c.rdb, keys, argv...).Err()
+}
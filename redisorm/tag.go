@@ -0,0 +1,164 @@
+package redisorm
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxNestDepth حداکثر عمق پیمایش structهای تودرتو و جاسازی‌شده است (برای انواع بازگشتی).
+const maxNestDepth = 8
+
+// redisTag نتیجه تجزیه تگ redis با قالب "name,opt1,opt2=value" است.
+// name می‌تواند خالی، "pk"، "version" یا "-" (نادیده گرفتن فیلد) باشد.
+type redisTag struct {
+	Name string
+	Opts map[string]string
+}
+
+func parseRedisTag(tag string) redisTag {
+	parts := strings.Split(tag, ",")
+	t := redisTag{Name: strings.TrimSpace(parts[0]), Opts: map[string]string{}}
+	for _, p := range parts[1:] {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(p, "=")
+		t.Opts[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return t
+}
+
+func (t redisTag) has(opt string) bool {
+	_, ok := t.Opts[opt]
+	return ok
+}
+
+// modelField یک فیلد مدل است؛ فیلدهای struct جاسازی‌شده با نام خود (مانند ID از BaseModel) و
+// فیلدهای struct تودرتو با مسیر نقطه‌دار (مانند Address.City) ثبت می‌شوند.
+type modelField struct {
+	Name      string   // نام Go یا مسیر نقطه‌دار
+	JSONPath  []string // مسیر فیلد در سند JSON
+	Type      reflect.Type
+	Tag       redisTag
+	Secret    string // مقدار خام تگ secret
+	HasSecret bool
+	Default   string // مقدار تگ default
+	Nested    bool   // داخل یک struct تودرتو (غیر جاسازی‌شده) قرار دارد
+	depth     int
+}
+
+// collectFields فیلدهای یک struct را مانند encoding/json پیمایش می‌کند: structهای جاسازی‌شده
+// بدون نام JSON تخت می‌شوند و از structهای تودرتو فقط فیلدهای دارای تگ برداشته می‌شوند.
+func collectFields(rt reflect.Type) []modelField {
+	var out []modelField
+	walkFields(rt, "", nil, false, 0, &out)
+
+	// مانند Go، فیلد کم‌عمق‌تر بر فیلد هم‌نام در struct جاسازی‌شده اولویت دارد.
+	best := map[string]int{}
+	for i, f := range out {
+		if j, ok := best[f.Name]; !ok || f.depth < out[j].depth {
+			best[f.Name] = i
+		}
+	}
+	fields := out[:0:0]
+	for i, f := range out {
+		if best[f.Name] == i {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+func walkFields(rt reflect.Type, goPrefix string, jsonPrefix []string, nested bool, depth int, out *[]modelField) {
+	if depth > maxNestDepth {
+		return
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		// مانند encoding/json، تگ "-" فیلد را حذف می‌کند اما "-," یعنی نام JSON "-".
+		jsonTag := f.Tag.Get("json")
+		if jsonTag == "-" {
+			continue
+		}
+		jsonName, _, _ := strings.Cut(jsonTag, ",")
+		if f.Anonymous && jsonName == "" && f.Type.Kind() == reflect.Struct {
+			walkFields(f.Type, goPrefix, jsonPrefix, nested, depth+1, out)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+		mf := modelField{
+			Name:     goPrefix + f.Name,
+			JSONPath: append(slices.Clip(jsonPrefix), jsonName),
+			Type:     f.Type,
+			Tag:      parseRedisTag(f.Tag.Get("redis")),
+			Nested:   nested,
+			depth:    depth,
+		}
+		mf.Secret, mf.HasSecret = f.Tag.Lookup("secret")
+		mf.Default = f.Tag.Get("default")
+		_, hasRedis := f.Tag.Lookup("redis")
+		if !nested || hasRedis || mf.HasSecret {
+			*out = append(*out, mf)
+		}
+		if st := nestedStruct(f.Type); st != nil && mf.Tag.Name != "-" {
+			walkFields(st, mf.Name+".", mf.JSONPath, true, depth+1, out)
+		}
+	}
+}
+
+// nestedStruct نوع struct یک فیلد تودرتو (struct یا اشاره‌گر به struct) را برمی‌گرداند.
+// time.Time یک مقدار ساده محسوب می‌شود.
+func nestedStruct(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) {
+		return nil
+	}
+	return t
+}
+
+// fieldByPath فیلد (یا مسیر نقطه‌دار) را از مقدار struct برمی‌گرداند. اگر یکی از اشاره‌گرهای
+// میانی nil باشد مقدار نامعتبر برگردانده می‌شود.
+func fieldByPath(rv reflect.Value, name string) reflect.Value {
+	for _, part := range strings.Split(name, ".") {
+		for rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return reflect.Value{}
+			}
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		rv = rv.FieldByName(part)
+	}
+	return rv
+}
+
+// docValue مقدار یک فیلد (یا مسیر تودرتو) را از سند JSON رمزگشایی‌شده برمی‌گرداند.
+func docValue(m map[string]any, meta *ModelMetadata, fieldName string) (any, bool) {
+	path := meta.JsonPaths[fieldName]
+	if len(path) == 0 {
+		return nil, false
+	}
+	var cur any = m
+	for _, p := range path {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[p]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
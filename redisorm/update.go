@@ -9,21 +9,20 @@ import (
 func applyUpdatesByJSONName(dst any, updates map[string]any) {
 	rv := reflect.ValueOf(dst); if rv.Kind() != reflect.Pointer || rv.IsNil() { return }
 	rv = rv.Elem(); rt := rv.Type()
-	nameToIndex := map[string]int{}
-	for i := 0; i < rt.NumField(); i++ {
-		f := rt.Field(i)
-		if f.PkgPath != "" { continue }
+	nameToIndex := map[string][]int{}
+	for _, f := range reflect.VisibleFields(rt) {
+		if !f.IsExported() || f.Anonymous { continue }
 		name := f.Name
 		if tag := f.Tag.Get("json"); tag != "" {
 			parts := strings.Split(tag, ",")
 			if parts[0] != "" && parts[0] != "-" { name = parts[0] }
 		}
-		nameToIndex[name] = i
-		nameToIndex[f.Name] = i
+		nameToIndex[name] = f.Index
+		nameToIndex[f.Name] = f.Index
 	}
 	for k, val := range updates {
 		if idx, ok := nameToIndex[k]; ok {
-			fv := rv.Field(idx)
+			fv := rv.FieldByIndex(idx)
 			if !fv.CanSet() { continue }
 			setReflectValue(fv, val)
 		}
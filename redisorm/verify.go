@@ -0,0 +1,472 @@
+package redisorm
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// IssueKind نوع ناسازگاری بین ایندکس‌ها و رکوردهای ذخیره‌شده است.
+type IssueKind string
+
+const (
+	// IssueDangling عضو ایندکس یا کلید یکتایی است که رکوردش وجود ندارد یا آن مقدار را ندارد.
+	IssueDangling IssueKind = "dangling"
+	// IssueMissing ورودی ایندکس یا کلید یکتایی است که رکورد باید داشته باشد اما ندارد.
+	IssueMissing IssueKind = "missing"
+	// IssueConflict کلید یکتایی است که رکورد دیگری با همان مقدار آن را در اختیار دارد؛ این
+	// مورد داده تکراری است و Repair آن را تغییر نمی‌دهد.
+	IssueConflict IssueKind = "conflict"
+	// IssueShadow shadow رکوردی است که با کلیدهای ایندکسی آن یکی نیست.
+	IssueShadow IssueKind = "shadow"
+	// IssueUndecryptable رکوردی است که یک فیلد محرمانه آن رمزگشایی نمی‌شود (کلید نادرست یا
+	// ciphertext خراب)؛ کلیدهای ایندکسی آن قابل محاسبه نیست و Repair نه آن و نه ورودی‌های
+	// ایندکسی‌اش را تغییر نمی‌دهد.
+	IssueUndecryptable IssueKind = "undecryptable"
+)
+
+// IndexIssue یک ناسازگاری یافت‌شده است.
+type IndexIssue struct {
+	Kind IssueKind
+	Key  string // کلید ایندکس، یکتا یا shadow
+	ID   string // شناسه رکورد
+}
+
+func (i IndexIssue) String() string {
+	return fmt.Sprintf("%s %s id=%s", i.Kind, i.Key, i.ID)
+}
+
+// IndexReport نتیجه Verify یا Repair برای یک مدل است.
+type IndexReport struct {
+	Model    string
+	Records  int          // تعداد رکوردهای پیمایش‌شده
+	Issues   []IndexIssue // ناسازگاری‌های یافت‌شده پیش از اصلاح
+	Repaired int          // تعداد اصلاح‌های انجام‌شده (فقط در Repair)
+}
+
+// Count تعداد ناسازگاری‌های نوع kind را برمی‌گرداند.
+func (r *IndexReport) Count(kind IssueKind) int {
+	n := 0
+	for _, i := range r.Issues {
+		if i.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// ErrIndexInconsistent زمانی برگردانده می‌شود که IndexCommand بدون -repair ناسازگاری پیدا کند.
+var ErrIndexInconsistent = errors.New("index inconsistencies found")
+
+// Verify همه رکوردها و کلیدهای index، index_enc، unique و unique_enc یک مدل را پیمایش می‌کند و
+// اعضای ایندکس بدون رکورد، ورودی‌های جاافتاده، کلیدهای یکتایی که به رکورد ناموجود یا دیگری
+// اشاره می‌کنند و shadowهای ناهماهنگ را گزارش می‌کند. چیزی تغییر داده نمی‌شود.
+func (c *Client) Verify(ctx context.Context, model any) (*IndexReport, error) {
+	return c.checkIndexes(ctx, model, false)
+}
+
+// Repair مانند Verify پیمایش می‌کند و ناسازگاری‌ها را دسته‌ای اصلاح می‌کند. هر اصلاح در یک
+// اسکریپت Lua و فقط در صورتی انجام می‌شود که رکورد از زمان خواندن تغییر نکرده باشد، پس اجرای
+// آن روی سرویس در حال کار امن است.
+func (c *Client) Repair(ctx context.Context, model any) (*IndexReport, error) {
+	return c.checkIndexes(ctx, model, true)
+}
+
+// recordState سند ذخیره‌شده یک رکورد و کلیدهای ایندکسی مورد انتظار آن است.
+type recordState struct {
+	enc   string
+	slots map[string]string
+	// undecryptable یعنی slots معلوم نیست؛ ورودی‌های ایندکسی رکورد دست نخورده می‌مانند.
+	undecryptable bool
+}
+
+// claims مشخص می‌کند آیا رکورد کلید key را در یکی از slotهای خود دارد. برای رکورد رمزگشایی‌نشده
+// true برگردانده می‌شود تا ورودی‌های آن حذف یا به رکورد دیگری داده نشوند.
+func (r *recordState) claims(key string) bool {
+	if r == nil {
+		return false
+	}
+	if r.undecryptable {
+		return true
+	}
+	for _, k := range r.slots {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) checkIndexes(ctx context.Context, model any, repair bool) (*IndexReport, error) {
+	meta, err := c.getModelMetadata(model)
+	if err != nil {
+		return nil, err
+	}
+	chk := &indexCheck{c: c, meta: meta, modelPrefix: c.modelPrefix(meta), repair: repair}
+	chk.report.Model = c.modelName(meta)
+
+	// ابتدا ورودی‌های اضافه حذف می‌شوند تا کلیدهای یکتای کهنه برای رکورد صاحب واقعی آزاد شوند.
+	for _, kind := range []string{"idx", "idxenc"} {
+		if err := c.scanKeys(ctx, c.keyPattern(kind, chk.modelPrefix), func(keys []string) error {
+			for _, key := range keys {
+				if err := chk.checkSet(ctx, key); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	for _, kind := range []string{"uniq", "uniqenc"} {
+		if err := c.scanKeys(ctx, c.keyPattern(kind, chk.modelPrefix), func(keys []string) error {
+			return chk.checkUnique(ctx, keys)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	valPrefix := c.keyVal(chk.modelPrefix, "")
+	if err := c.scanKeys(ctx, c.keyPattern("val", chk.modelPrefix), func(keys []string) error {
+		ids := make([]string, len(keys))
+		for i, k := range keys {
+			ids[i] = strings.TrimPrefix(k, valPrefix)
+		}
+		return chk.checkRecords(ctx, ids)
+	}); err != nil {
+		return nil, err
+	}
+	return &chk.report, nil
+}
+
+type indexCheck struct {
+	c           *Client
+	meta        *ModelMetadata
+	modelPrefix string
+	repair      bool
+	report      IndexReport
+}
+
+// load رکوردهای ids را می‌خواند و کلیدهای ایندکسی مورد انتظار آن‌ها را محاسبه می‌کند؛ رکوردهای
+// ناموجود در خروجی nil هستند.
+func (chk *indexCheck) load(ctx context.Context, ids []string) (map[string]*recordState, error) {
+	c := chk.c
+	pipe := c.rdb.Pipeline()
+	gets := make(map[string]*redis.StringCmd, len(ids))
+	for _, id := range ids {
+		if _, ok := gets[id]; !ok {
+			gets[id] = pipe.Get(ctx, c.keyVal(chk.modelPrefix, id))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+	out := make(map[string]*recordState, len(gets))
+	for id, cmd := range gets {
+		enc, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			out[id] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// رمزگشایی همیشه strict است تا ایندکس‌ها از مقدار صفرشده ساخته نشوند.
+		plain, err := c.decryptStrict(ctx, chk.meta, id, enc)
+		var derr *DecryptError
+		if errors.As(err, &derr) {
+			out[id] = &recordState{enc: enc, undecryptable: true}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", id, err)
+		}
+		out[id] = &recordState{enc: enc, slots: c.indexSlots(chk.meta, chk.modelPrefix, storedTenant(chk.meta, enc), plain)}
+	}
+	return out, nil
+}
+
+// drop عضو id را از ایندکس یا کلید یکتای key حذف می‌کند، مگر اینکه رکورد تغییر کرده باشد.
+func (chk *indexCheck) drop(ctx context.Context, key, id string, rec *recordState) error {
+	chk.report.Issues = append(chk.report.Issues, IndexIssue{Kind: IssueDangling, Key: key, ID: id})
+	if !chk.repair {
+		return nil
+	}
+	expected := ""
+	if rec != nil {
+		expected = rec.enc
+	}
+	n, err := chk.c.luaRepairDrop.Run(ctx, chk.c.rdb, []string{key, chk.c.keyVal(chk.modelPrefix, id)}, id, expected).Int()
+	if err != nil {
+		return err
+	}
+	chk.report.Repaired += n
+	return nil
+}
+
+// repairRecord اسکریپت luaRepairRecord را همراه کلید مقدار مالکان فعلی کلیدهای یکتای uniq اجرا
+// می‌کند و اگر مالکان همزمان تغییر کنند دوباره آن‌ها را می‌خواند.
+func (chk *indexCheck) repairRecord(ctx context.Context, id string, keys []string, argv []interface{}, uniq []string) (int, error) {
+	for attempt := 0; attempt < shadowRetries; attempt++ {
+		current, err := chk.c.currentKeys(ctx, chk.modelPrefix, id, uniq)
+		if err != nil {
+			return 0, err
+		}
+		n, err := chk.c.luaRepairRecord.Run(ctx, chk.c.rdb, append(slices.Clip(keys), current...), argv...).Int()
+		if !isStaleKeys(err) {
+			return n, err
+		}
+	}
+	return 0, fmt.Errorf("repair %s: %w", id, ErrIndexKeysChanged)
+}
+
+func (chk *indexCheck) checkSet(ctx context.Context, key string) error {
+	var cursor uint64
+	for {
+		ids, next, err := chk.c.rdb.SScan(ctx, key, cursor, "", scanBatch).Result()
+		if err != nil {
+			return err
+		}
+		records, err := chk.load(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if rec := records[id]; !rec.claims(key) {
+				if err := chk.drop(ctx, key, id, rec); err != nil {
+					return err
+				}
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (chk *indexCheck) checkUnique(ctx context.Context, keys []string) error {
+	pipe := chk.c.rdb.Pipeline()
+	gets := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		gets[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+	owners := make([]string, 0, len(keys))
+	for _, cmd := range gets {
+		if cmd.Err() == nil {
+			owners = append(owners, cmd.Val())
+		}
+	}
+	records, err := chk.load(ctx, owners)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if gets[i].Err() != nil {
+			continue // همزمان حذف شده است
+		}
+		owner := gets[i].Val()
+		if rec := records[owner]; !rec.claims(key) {
+			if err := chk.drop(ctx, key, owner, rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (chk *indexCheck) checkRecords(ctx context.Context, ids []string) error {
+	c := chk.c
+	records, err := chk.load(ctx, ids)
+	if err != nil {
+		return err
+	}
+	names := slotNames(chk.meta)
+	if len(names) == 0 {
+		for _, rec := range records {
+			if rec != nil {
+				chk.report.Records++
+			}
+		}
+		return nil
+	}
+
+	type probe struct {
+		member *redis.BoolCmd
+		owner  *redis.StringCmd
+	}
+	pipe := c.rdb.Pipeline()
+	shadows := map[string]*redis.MapStringStringCmd{}
+	probes := map[string]map[string]probe{}
+	for id, rec := range records {
+		if rec == nil || rec.undecryptable {
+			continue
+		}
+		shadows[id] = pipe.HGetAll(ctx, c.keyShadow(chk.modelPrefix, id))
+		probes[id] = map[string]probe{}
+		for slot, key := range rec.slots {
+			if strings.HasPrefix(slot, "uniq") {
+				probes[id][slot] = probe{owner: pipe.Get(ctx, key)}
+			} else {
+				probes[id][slot] = probe{member: pipe.SIsMember(ctx, key, id)}
+			}
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return err
+	}
+
+	// صاحبان دیگر کلیدهای یکتا برای تشخیص داده تکراری از داده کهنه خوانده می‌شوند.
+	var others []string
+	for id, ps := range probes {
+		for _, p := range ps {
+			if p.owner != nil && p.owner.Err() == nil && p.owner.Val() != id {
+				others = append(others, p.owner.Val())
+			}
+		}
+	}
+	owners, err := chk.load(ctx, others)
+	if err != nil {
+		return err
+	}
+
+	for id, rec := range records {
+		if rec == nil {
+			continue // همزمان حذف یا منقضی شده است
+		}
+		chk.report.Records++
+		if rec.undecryptable {
+			chk.report.Issues = append(chk.report.Issues, IndexIssue{Kind: IssueUndecryptable, Key: c.keyVal(chk.modelPrefix, id), ID: id})
+			continue
+		}
+		fix := false
+		for _, slot := range names {
+			key, ok := rec.slots[slot]
+			if !ok {
+				continue
+			}
+			p := probes[id][slot]
+			kind := IssueKind("")
+			switch {
+			case p.member != nil:
+				if !p.member.Val() {
+					kind = IssueMissing
+				}
+			case p.owner.Err() != nil:
+				kind = IssueMissing
+			case p.owner.Val() != id:
+				if owners[p.owner.Val()].claims(key) {
+					kind = IssueConflict
+				} else {
+					kind = IssueMissing
+				}
+			}
+			if kind != "" {
+				chk.report.Issues = append(chk.report.Issues, IndexIssue{Kind: kind, Key: key, ID: id})
+				fix = fix || kind == IssueMissing
+			}
+		}
+
+		want := map[string]string{"_": "1"}
+		maps.Copy(want, rec.slots)
+		for slot, key := range rec.slots {
+			if p := probes[id][slot]; p.owner != nil && p.owner.Val() != id && owners[p.owner.Val()].claims(key) {
+				delete(want, slot) // کلید در اختیار رکورد دیگری است و در shadow این رکورد ثبت نمی‌شود
+			}
+		}
+		if !maps.Equal(want, shadows[id].Val()) {
+			chk.report.Issues = append(chk.report.Issues, IndexIssue{Kind: IssueShadow, Key: c.keyShadow(chk.modelPrefix, id), ID: id})
+			fix = true
+		}
+
+		if fix && chk.repair {
+			keys := []string{c.keyVal(chk.modelPrefix, id), c.keyShadow(chk.modelPrefix, id)}
+			argv := []interface{}{rec.enc, id}
+			for _, slot := range names {
+				if key, ok := rec.slots[slot]; ok {
+					keys = append(keys, key)
+					argv = append(argv, slot)
+				}
+			}
+			n, err := chk.repairRecord(ctx, id, keys, argv, uniqKeys(names, rec.slots))
+			if err != nil {
+				return err
+			}
+			chk.report.Repaired += n
+		}
+	}
+	return nil
+}
+
+// IndexCommand یک رابط خط فرمان برای Verify و Repair است تا سرویس‌ها بتوانند آن را با مدل‌های
+// خود در یک برنامه کوچک قرار دهند:
+//
+//	func main() {
+//		orm, _ := redisorm.New(rdb, redisorm.WithNamespace("myapp"))
+//		if err := orm.IndexCommand(context.Background(), os.Args[1:], os.Stdout, &User{}, &Order{}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// پرچم‌ها: -repair برای اصلاح، -model برای محدود کردن به یک مدل (نام مدل مانند "sessions:Session")
+// و -v برای چاپ تک‌تک ناسازگاری‌ها. بدون -repair در صورت یافتن ناسازگاری ErrIndexInconsistent
+// برگردانده می‌شود.
+func (c *Client) IndexCommand(ctx context.Context, args []string, out io.Writer, models ...any) error {
+	fs := flag.NewFlagSet("redisorm-index", flag.ContinueOnError)
+	fs.SetOutput(out)
+	repair := fs.Bool("repair", false, "fix the inconsistencies found")
+	only := fs.String("model", "", "check only this model")
+	verbose := fs.Bool("v", false, "print every inconsistency")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	inconsistent := false
+	matched := false
+	for _, m := range models {
+		meta, err := c.getModelMetadata(m)
+		if err != nil {
+			return err
+		}
+		if *only != "" && *only != c.modelName(meta) && *only != meta.StructName {
+			continue
+		}
+		matched = true
+		report, err := c.checkIndexes(ctx, m, *repair)
+		if err != nil {
+			return fmt.Errorf("%s: %w", c.modelName(meta), err)
+		}
+		fmt.Fprintf(out, "%s: %d records, %d dangling, %d missing, %d conflict, %d shadow, %d undecryptable",
+			report.Model, report.Records, report.Count(IssueDangling), report.Count(IssueMissing),
+			report.Count(IssueConflict), report.Count(IssueShadow), report.Count(IssueUndecryptable))
+		if *repair {
+			fmt.Fprintf(out, ", %d repaired", report.Repaired)
+		}
+		fmt.Fprintln(out)
+		if *verbose {
+			for _, issue := range report.Issues {
+				fmt.Fprintf(out, "  %s\n", issue)
+			}
+		}
+		if len(report.Issues) > 0 {
+			inconsistent = true
+		}
+	}
+	if *only != "" && !matched {
+		return fmt.Errorf("unknown model %q", *only)
+	}
+	if inconsistent && !*repair {
+		return ErrIndexInconsistent
+	}
+	return nil
+}
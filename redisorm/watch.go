@@ -0,0 +1,98 @@
+package redisorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// watchBuffer ظرفیت کانال رویدادهای Watch است.
+const watchBuffer = 64
+
+// WithChangeNotifications هر Save، Delete و UpdateFieldsFast را در همان اسکریپت Lua روی کانال
+// Pub/Sub رکورد ({namespace}:chg:{ModelName}:{id}) منتشر می‌کند تا Watch و WatchModel کار کنند.
+// تحویل اعلان‌ها best-effort است؛ برای تحویل تضمینی از ChangeCapturer و Subscribe استفاده کنید.
+func WithChangeNotifications() Option {
+	return func(c *Client) { c.notify = true }
+}
+
+func (c *Client) keyWatch(modelPrefix, id string) string {
+	return fmt.Sprintf("%s:chg:%s:%s", c.ns, modelPrefix, id)
+}
+
+// Watch تغییرات یک رکورد را روی کانال برگشتی ارسال می‌کند؛ id مانند Load تعیین می‌شود. با لغو
+// ctx اشتراک لغو و کانال بسته می‌شود. اتصال‌های قطع‌شده را go-redis دوباره برقرار می‌کند، اما
+// اعلان‌های زمان قطع اتصال از دست می‌روند.
+func (c *Client) Watch(ctx context.Context, sample any, id any) (<-chan ChangeEvent, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return nil, err
+	}
+	key, err := recordID(meta, sample, id)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("empty pk for Watch")
+	}
+	if !c.notify {
+		return nil, errors.New("change notifications are disabled; use WithChangeNotifications")
+	}
+	return c.watch(ctx, c.rdb.Subscribe(ctx, c.keyWatch(c.modelPrefix(meta), key)))
+}
+
+// WatchModel تغییرات همه رکوردهای یک مدل را روی کانال برگشتی ارسال می‌کند.
+func (c *Client) WatchModel(ctx context.Context, sample any) (<-chan ChangeEvent, error) {
+	meta, err := c.getModelMetadata(sample)
+	if err != nil {
+		return nil, err
+	}
+	if !c.notify {
+		return nil, errors.New("change notifications are disabled; use WithChangeNotifications")
+	}
+	return c.watch(ctx, c.rdb.PSubscribe(ctx, c.keyPattern("chg", c.modelPrefix(meta))))
+}
+
+func (c *Client) watch(ctx context.Context, ps *redis.PubSub) (<-chan ChangeEvent, error) {
+	// منتظر تأیید اشتراک می‌مانیم تا اعلان‌های پس از بازگشت Watch از دست نروند.
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+	out := make(chan ChangeEvent, watchBuffer)
+	go func() {
+		defer close(out)
+		defer ps.Close()
+		msgs := ps.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var raw struct {
+					Op      string   `json:"op"`
+					Model   string   `json:"model"`
+					ID      string   `json:"id"`
+					Version int64    `json:"version"`
+					Fields  []string `json:"fields"`
+				}
+				if err := json.Unmarshal([]byte(msg.Payload), &raw); err != nil {
+					continue
+				}
+				ev := ChangeEvent{Op: raw.Op, Model: raw.Model, ID: raw.ID, Version: raw.Version, Fields: raw.Fields}
+				select {
+				case out <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,248 @@
+package redisorm_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+)
+
+// Article تغییرات خود را همراه سند در stream ثبت می‌کند.
+type Article struct {
+	ID     string `json:"id" redis:"pk"`
+	Title  string `json:"title"`
+	Status string `json:"status" redis:",index"`
+	Author string `json:"author" secret:"true"`
+}
+
+func (a *Article) ChangeCapture() redisorm.ChangeCapture {
+	return redisorm.ChangeCapture{IncludeDocument: true}
+}
+
+func TestChangeCapture(t *testing.T) {
+	orm, ns := setupClient(t)
+	repo, err := redisorm.NewRepo[Article](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+
+	if _, err := repo.Save(ctx, &Article{ID: "a1", Title: "Draft", Status: "draft", Author: "alice"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := orm.UpdateFieldsFast(ctx, &Article{}, "a1", map[string]any{"status": "published"}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	if err := repo.Delete(ctx, "a1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if n := rdb.XLen(ctx, ns+":cdc:Article").Val(); n != 3 {
+		t.Fatalf("Expected 3 change events, got %d", n)
+	}
+
+	// خواندن همه رویدادها از ابتدای stream.
+	collect := func(opts ...redisorm.SubscribeOption) []redisorm.ChangeEvent {
+		var events []redisorm.ChangeEvent
+		subCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		err := orm.Subscribe(subCtx, &Article{}, "audit", func(ctx context.Context, ev redisorm.ChangeEvent) error {
+			events = append(events, ev)
+			if len(events) == 3 {
+				cancel()
+			}
+			return nil
+		}, opts...)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected Subscribe to stop on cancel, got %v", err)
+		}
+		return events
+	}
+	events := collect(redisorm.StartFrom("0"))
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %d", len(events))
+	}
+	if ops := []string{events[0].Op, events[1].Op, events[2].Op}; !slices.Equal(ops, []string{redisorm.OpCreate, redisorm.OpUpdate, redisorm.OpDelete}) {
+		t.Errorf("Unexpected operations %v", ops)
+	}
+	if !slices.Equal(events[1].Fields, []string{"status"}) || events[1].ID != "a1" || events[1].Model != "Article" {
+		t.Errorf("Unexpected update event %+v", events[1])
+	}
+	var got Article
+	if err := orm.DecodeChange(ctx, events[1], &got); err != nil {
+		t.Fatalf("DecodeChange failed: %v", err)
+	}
+	if got.Status != "published" || got.Author != "alice" {
+		t.Errorf("Unexpected decoded document %+v", got)
+	}
+
+	// رویدادی که handler آن خطا می‌دهد تأیید نمی‌شود و دوباره تحویل داده می‌شود.
+	if _, err := repo.Save(ctx, &Article{ID: "a2", Title: "Next", Status: "draft"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	failure := errors.New("handler failed")
+	err = orm.Subscribe(ctx, &Article{}, "audit", func(ctx context.Context, ev redisorm.ChangeEvent) error {
+		return failure
+	}, redisorm.WithConsumer("worker-1"))
+	if !errors.Is(err, failure) {
+		t.Fatalf("Expected handler error, got %v", err)
+	}
+	subCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var redelivered string
+	_ = orm.Subscribe(subCtx, &Article{}, "audit", func(ctx context.Context, ev redisorm.ChangeEvent) error {
+		redelivered = ev.ID
+		cancel()
+		return nil
+	}, redisorm.WithConsumer("worker-1"))
+	if redelivered != "a2" {
+		t.Errorf("Expected pending event for a2 to be redelivered, got %q", redelivered)
+	}
+
+	// بازگرداندن موقعیت گروه، رویدادها را دوباره پخش می‌کند.
+	if replay := collect(redisorm.StartFrom("0")); len(replay) != 3 || replay[0].ID != "a1" {
+		t.Errorf("Expected replay from the beginning, got %v", replay)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	_, ns := setupClient(t)
+	orm := newClientInNamespace(t, ns, redisorm.WithMasterKey([]byte("0123456789abcdef0123456789abcdef")), redisorm.WithChangeNotifications())
+	watchCtx, cancel := context.WithCancel(ctx)
+	sess := orm.WithContext(watchCtx)
+
+	one, err := sess.Watch(&Customer{}, "c1")
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	all, err := sess.WatchModel(&Customer{})
+	if err != nil {
+		t.Fatalf("WatchModel failed: %v", err)
+	}
+
+	if _, err := sess.Save(&Customer{ID: "c1", Country: "IR", Status: "active"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := sess.Save(&Customer{ID: "c2", Country: "DE", Status: "active"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := sess.UpdateFieldsFast(&Customer{}, "c1", map[string]any{"status": "blocked"}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	if err := sess.Delete(&Customer{}, "c1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	next := func(ch <-chan redisorm.ChangeEvent) redisorm.ChangeEvent {
+		select {
+		case ev := <-ch:
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for a change notification")
+			return redisorm.ChangeEvent{}
+		}
+	}
+	var ops []string
+	for range 3 {
+		ev := next(one)
+		if ev.ID != "c1" {
+			t.Errorf("Expected only c1 events on Watch, got %+v", ev)
+		}
+		ops = append(ops, ev.Op)
+	}
+	if !slices.Equal(ops, []string{redisorm.OpCreate, redisorm.OpUpdate, redisorm.OpDelete}) {
+		t.Errorf("Unexpected operations %v", ops)
+	}
+	var ids []string
+	for range 4 {
+		ids = append(ids, next(all).ID)
+	}
+	if !slices.Equal(ids, []string{"c1", "c2", "c1", "c1"}) {
+		t.Errorf("Unexpected WatchModel events %v", ids)
+	}
+
+	cancel()
+	if _, ok := <-one; ok {
+		t.Error("Expected Watch channel to be closed after cancel")
+	}
+}
+
+// Payment تغییرات خود را همراه انجام‌دهنده در سابقه ثبت می‌کند.
+type Payment struct {
+	ID     string `json:"id" redis:"pk"`
+	Amount int    `json:"amount"`
+	Status string `json:"status" redis:",index"`
+	IBAN   string `json:"iban" secret:"true"`
+}
+
+func (i *Payment) AuditTrail() redisorm.AuditTrail { return redisorm.AuditTrail{} }
+
+func TestAudit(t *testing.T) {
+	orm, _ := setupClient(t)
+	alice := orm.WithContext(redisorm.WithActor(ctx, redisorm.Actor{ID: "alice", Service: "billing", RequestID: "r1"}))
+	bob := orm.WithContext(redisorm.WithActor(ctx, redisorm.Actor{ID: "bob"}))
+
+	if _, err := alice.Save(&Payment{ID: "i1", Amount: 100, Status: "open", IBAN: "IR01"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := bob.UpdateFieldsFast(&Payment{}, "i1", map[string]any{"amount": 120}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	if _, err := alice.UpdateFields(&Payment{}, "i1", map[string]any{"status": "paid"}); err != nil {
+		t.Fatalf("UpdateFields failed: %v", err)
+	}
+	if _, err := alice.Save(&Payment{ID: "i2", Amount: 5, Status: "open"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := bob.Delete(&Payment{}, "i1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	log, err := orm.AuditLog(ctx, &Payment{}, "i1", 0)
+	if err != nil {
+		t.Fatalf("AuditLog failed: %v", err)
+	}
+	if len(log) != 4 {
+		t.Fatalf("Expected 4 audit entries for i1, got %d", len(log))
+	}
+	var ops, actors []string
+	for _, e := range log {
+		ops = append(ops, e.Op)
+		actors = append(actors, e.Actor.ID)
+	}
+	if !slices.Equal(ops, []string{redisorm.OpDelete, redisorm.OpUpdate, redisorm.OpUpdate, redisorm.OpCreate}) {
+		t.Errorf("Unexpected operations %v", ops)
+	}
+	if !slices.Equal(actors, []string{"bob", "alice", "bob", "alice"}) {
+		t.Errorf("Unexpected actors %v", actors)
+	}
+
+	created := log[3]
+	if created.Actor.Service != "billing" || created.Actor.RequestID != "r1" || created.Model != "Payment" {
+		t.Errorf("Unexpected create entry %+v", created)
+	}
+	if iban := created.Changes["iban"]; !iban.Masked || iban.New != nil {
+		t.Errorf("Expected secret field to be masked, got %+v", iban)
+	}
+	if amount := log[2].Changes["amount"]; string(amount.Old) != "100" || string(amount.New) != "120" || len(log[2].Changes) != 1 {
+		t.Errorf("Unexpected fast update diff %+v", log[2].Changes)
+	}
+	if status := log[1].Changes["status"]; string(status.Old) != `"open"` || string(status.New) != `"paid"` {
+		t.Errorf("Unexpected update diff %+v", log[1].Changes)
+	}
+	if status := log[0].Changes["status"]; string(status.Old) != `"paid"` || status.New != nil {
+		t.Errorf("Unexpected delete diff %+v", log[0].Changes)
+	}
+
+	byAlice, err := alice.AuditByActor(&Payment{}, "alice", 0)
+	if err != nil {
+		t.Fatalf("AuditByActor failed: %v", err)
+	}
+	if len(byAlice) != 3 || byAlice[0].ID != "i2" {
+		t.Errorf("Expected 3 entries by alice starting with i2, got %+v", byAlice)
+	}
+	if latest, _ := orm.AuditByActor(ctx, &Payment{}, "bob", 1); len(latest) != 1 || latest[0].Op != redisorm.OpDelete {
+		t.Errorf("Expected bob's latest entry to be the delete, got %+v", latest)
+	}
+}
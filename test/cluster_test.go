@@ -0,0 +1,111 @@
+package redisorm_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+	"github.com/redis/go-redis/v9"
+)
+
+// Parcel همه انواع کلیدهای یک رکورد (نسخه، ایندکس، یکتا، بازه‌ای، shadow و تاریخچه) را می‌سازد.
+type Parcel struct {
+	ID       string  `json:"id" redis:"pk,history=2"`
+	Version  int64   `json:"version" redis:"version"`
+	Carrier  string  `json:"carrier" redis:",index"`
+	Tracking string  `json:"tracking" redis:",unique"`
+	Weight   float64 `json:"weight" redis:",range"`
+}
+
+// keySlot شماره hash slot کلاستر یک کلید (CRC16 بخش hash tag آن، پیمانه 16384) است.
+func keySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return int(crc) % 16384
+}
+
+func TestHashTags(t *testing.T) {
+	setupClient(t)
+	// یک کلاینت کلاستر که همه slotها را به همین سرور مستقل نگاشت می‌کند.
+	cluster := redis.NewClusterClient(&redis.ClusterOptions{
+		ClusterSlots: func(context.Context) ([]redis.ClusterSlot, error) {
+			return []redis.ClusterSlot{{Start: 0, End: 16383, Nodes: []redis.ClusterNode{{Addr: "localhost:6379"}}}}, nil
+		},
+	})
+	defer cluster.Close()
+	ring := redis.NewRing(&redis.RingOptions{Addrs: map[string]string{"s1": "localhost:6379"}})
+	defer ring.Close()
+
+	for name, newClient := range map[string]func(ns string) *redisorm.Client{
+		"option": func(ns string) *redisorm.Client { return newClientInNamespace(t, ns, redisorm.WithHashTags()) },
+		"cluster": func(ns string) *redisorm.Client {
+			c, err := redisorm.New(cluster, redisorm.WithNamespace(ns))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			return c
+		},
+		"ring": func(ns string) *redisorm.Client {
+			c, err := redisorm.New(ring, redisorm.WithNamespace(ns))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			return c
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ns := fmt.Sprintf("test_slot_%d", time.Now().UnixNano())
+			orm := newClient(ns)
+			if _, err := orm.Save(ctx, &Parcel{ID: "s1", Carrier: "dhl", Tracking: "T-1", Weight: 2.5}); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			if _, err := orm.UpdateFieldsFast(ctx, &Parcel{}, "s1", map[string]any{"carrier": "ups"}); err != nil {
+				t.Fatalf("UpdateFieldsFast failed: %v", err)
+			}
+
+			keys, err := rdb.Keys(ctx, ns+":*").Result()
+			if err != nil {
+				t.Fatalf("Keys failed: %v", err)
+			}
+			if len(keys) < 6 {
+				t.Fatalf("Expected val, ver, idx, uniq, rng, shd and hist keys, got %v", keys)
+			}
+			slot := keySlot(ns + ":val:{Parcel}:s1")
+			for _, key := range keys {
+				if !strings.Contains(key, ":{Parcel}:") {
+					t.Errorf("Expected key %s to contain the {Parcel} hash tag", key)
+				}
+				if keySlot(key) != slot {
+					t.Errorf("Expected key %s in slot %d, got %d", key, slot, keySlot(key))
+				}
+			}
+		})
+	}
+
+	// بدون hash tag پیشوند مدل بدون {} است.
+	ns := fmt.Sprintf("test_slot_%d", time.Now().UnixNano())
+	plain := newClientInNamespace(t, ns)
+	if _, err := plain.Save(ctx, &Parcel{ID: "s1", Carrier: "dhl", Tracking: "T-1"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if n := rdb.Exists(ctx, ns+":val:Parcel:s1").Val(); n != 1 {
+		t.Error("Expected a plain client to write keys without hash tags")
+	}
+}
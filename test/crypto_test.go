@@ -0,0 +1,496 @@
+package redisorm_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+	"github.com/redis/go-redis/v9"
+)
+
+// Account مدلی با فیلد محرمانه و ایندکس رمز‌شده برای تست‌های رمزنگاری است.
+type Account struct {
+	ID         string `json:"id" redis:"pk"`
+	NationalID string `json:"national_id" secret:"true" redis:",index_enc"`
+	Note       string `json:"note" secret:"true"`
+}
+
+// newClientInNamespace یک کلاینت با فضای نام مشخص می‌سازد تا چند کلاینت داده مشترک ببینند.
+func newClientInNamespace(t testing.TB, ns string, opts ...redisorm.Option) *redisorm.Client {
+	setupClient(t)
+	client, err := redisorm.New(rdb, append([]redisorm.Option{redisorm.WithNamespace(ns)}, opts...)...)
+	if err != nil {
+		t.Fatalf("failed to create orm client: %v", err)
+	}
+	return client
+}
+
+func TestKeyRotation(t *testing.T) {
+	ns := fmt.Sprintf("test_rot_%d", time.Now().UnixNano())
+	oldKey := []byte("0123456789abcdef0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+
+	before := newClientInNamespace(t, ns, redisorm.WithMasterKey(oldKey)).WithContext(ctx)
+	id, err := before.Save(&Account{NationalID: "123-45", Note: "vip"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	rotating := newClientInNamespace(t, ns, redisorm.WithKeyring(
+		redisorm.MasterKey{ID: "k2", Key: newKey},
+		redisorm.MasterKey{ID: "default", Key: oldKey},
+	))
+	var acc Account
+	if err := rotating.WithContext(ctx).Load(&acc, id); err != nil || acc.Note != "vip" {
+		t.Fatalf("Expected retired key to decrypt old data, got %q (err: %v)", acc.Note, err)
+	}
+
+	n, err := rotating.RotateKeys(ctx, &Account{})
+	if err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 rotated record, got %d", n)
+	}
+
+	after := newClientInNamespace(t, ns, redisorm.WithKeyring(redisorm.MasterKey{ID: "k2", Key: newKey})).WithContext(ctx)
+	acc = Account{}
+	if err := after.Load(&acc, id); err != nil || acc.NationalID != "123-45" || acc.Note != "vip" {
+		t.Fatalf("Expected rotated data to decrypt with the new key only, got %+v (err: %v)", acc, err)
+	}
+	ids, _, err := after.PageIDsByEncIndex(&Account{}, "NationalID", "123-45", 0, 100)
+	if err != nil || len(ids) != 1 || ids[0] != id {
+		t.Errorf("Expected rebuilt index_enc to find the record, got %v (err: %v)", ids, err)
+	}
+	// ورودی زیر کلید قبلی از روی shadow رکورد حذف می‌شود.
+	if keys := rdb.Keys(ctx, ns+":idxenc:*").Val(); len(keys) != 1 {
+		t.Errorf("Expected only the rebuilt index_enc key, got %v", keys)
+	}
+}
+
+func TestStrictKeys(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+
+	if _, err := redisorm.New(client, redisorm.WithStrictKeys()); err == nil {
+		t.Errorf("Expected strict mode to reject a missing master key")
+	}
+	if _, err := redisorm.New(client, redisorm.WithStrictKeys(), redisorm.WithMasterKey([]byte("short"))); err == nil {
+		t.Errorf("Expected strict mode to reject an invalid master key")
+	}
+	if _, err := redisorm.New(client, redisorm.WithStrictKeys(), redisorm.WithMasterKey([]byte("0123456789abcdef"))); err != nil {
+		t.Errorf("Expected a valid master key to be accepted, got %v", err)
+	}
+
+	// خطای قالب نادرست نباید خود کلید را نشان دهد.
+	secret := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	t.Setenv("ORM_TEST_KEYS", "k1:"+secret+","+secret)
+	_, err := redisorm.LocalKeyProviderFromEnv("ORM_TEST_KEYS")
+	if err == nil || strings.Contains(err.Error(), secret) || !strings.Contains(err.Error(), "entry 2") {
+		t.Errorf("Expected an error naming entry 2 without the key, got %v", err)
+	}
+}
+
+func TestEnvelopeEncryption(t *testing.T) {
+	kms, err := redisorm.NewMemoryKMS(map[string][]byte{
+		"kms-1": []byte("0123456789abcdef0123456789abcdef"),
+		"kms-2": []byte("fedcba9876543210fedcba9876543210"),
+	})
+	if err != nil {
+		t.Fatalf("NewMemoryKMS failed: %v", err)
+	}
+	ns := fmt.Sprintf("test_env_%d", time.Now().UnixNano())
+	masterKey := redisorm.WithMasterKey([]byte("0123456789abcdef0123456789abcdef"))
+
+	sess := newClientInNamespace(t, ns, masterKey, redisorm.WithKeyProvider(redisorm.NewKMSKeyProvider(kms, "kms-1"))).WithContext(ctx)
+	id, err := sess.Save(&Account{NationalID: "987-65", Note: "envelope"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	raw, err := rdb.Get(ctx, fmt.Sprintf("%s:val:Account:%s", ns, id)).Result()
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	if !strings.Contains(raw, "encf:v2:env:") || strings.Contains(raw, "envelope") {
+		t.Errorf("Expected envelope ciphertext in stored document, got %s", raw)
+	}
+
+	rotated := newClientInNamespace(t, ns, masterKey, redisorm.WithKeyProvider(redisorm.NewKMSKeyProvider(kms, "kms-2")))
+	if n, err := rotated.RotateKeys(ctx, &Account{}); err != nil || n != 1 {
+		t.Fatalf("Expected 1 record to be re-wrapped, got %d (err: %v)", n, err)
+	}
+	var acc Account
+	if err := rotated.WithContext(ctx).Load(&acc, id); err != nil || acc.Note != "envelope" {
+		t.Fatalf("Expected envelope data to decrypt after rotation, got %q (err: %v)", acc.Note, err)
+	}
+}
+
+// Wallet مدلی با فیلدهای محرمانه غیررشته‌ای است.
+type Wallet struct {
+	ID            string            `json:"id" redis:"pk"`
+	Balance       int64             `json:"balance" secret:"true"`
+	RecoveryCodes []string          `json:"recovery_codes" secret:"true"`
+	Address       *WalletAddress    `json:"address" secret:"true"`
+	Labels        map[string]string `json:"labels" secret:"true"`
+}
+
+type WalletAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street"`
+}
+
+func TestSecretNonStringFields(t *testing.T) {
+	ns := fmt.Sprintf("test_secret_types_%d", time.Now().UnixNano())
+	sess := newClientInNamespace(t, ns, redisorm.WithMasterKey([]byte("0123456789abcdef0123456789abcdef"))).WithContext(ctx)
+
+	w := &Wallet{
+		Balance:       9007199254740993,
+		RecoveryCodes: []string{"alpha-1", "bravo-2"},
+		Address:       &WalletAddress{City: "Tehran", Street: "Valiasr"},
+	}
+	id, err := sess.Save(w)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	raw, err := rdb.Get(ctx, fmt.Sprintf("%s:val:Wallet:%s", ns, id)).Result()
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	for _, plain := range []string{"9007199254740993", "alpha-1", "Tehran"} {
+		if strings.Contains(raw, plain) {
+			t.Errorf("Expected %q to be encrypted in stored document, got %s", plain, raw)
+		}
+	}
+
+	var loaded Wallet
+	if err := sess.Load(&loaded, id); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Balance != w.Balance || len(loaded.RecoveryCodes) != 2 || loaded.RecoveryCodes[1] != "bravo-2" ||
+		loaded.Address == nil || loaded.Address.City != "Tehran" || loaded.Labels != nil {
+		t.Fatalf("Expected secret fields to round-trip, got %+v", loaded)
+	}
+
+	if _, err := sess.UpdateFieldsFast(&Wallet{}, id, map[string]any{"recovery_codes": []string{"charlie-3"}, "balance": 7}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	loaded = Wallet{}
+	if err := sess.Load(&loaded, id); err != nil {
+		t.Fatalf("Load after update failed: %v", err)
+	}
+	if loaded.Balance != 7 || len(loaded.RecoveryCodes) != 1 || loaded.RecoveryCodes[0] != "charlie-3" {
+		t.Errorf("Expected encrypted partial update to apply, got %+v", loaded)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	ns := fmt.Sprintf("test_decrypt_err_%d", time.Now().UnixNano())
+	writer := newClientInNamespace(t, ns, redisorm.WithMasterKey([]byte("0123456789abcdef0123456789abcdef"))).WithContext(ctx)
+	id, err := writer.Save(&Account{NationalID: "555-11", Note: "secret note"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	wrongKey := redisorm.WithMasterKey([]byte("fedcba9876543210fedcba9876543210"))
+
+	strict := newClientInNamespace(t, ns, wrongKey, redisorm.WithStrictDecryption()).WithContext(ctx)
+	var acc Account
+	err = strict.Load(&acc, id)
+	var derr *redisorm.DecryptError
+	if !errors.As(err, &derr) {
+		t.Fatalf("Expected *DecryptError in strict mode, got %v", err)
+	}
+	if derr.Model != "Account" || derr.ID != id || derr.Field == "" {
+		t.Errorf("Unexpected decrypt error details: %+v", derr)
+	}
+
+	var reported []string
+	lenientClient := newClientInNamespace(t, ns, wrongKey, redisorm.WithDecryptErrorHandler(func(e *redisorm.DecryptError) {
+		reported = append(reported, e.Field)
+	}))
+	lenient := lenientClient.WithContext(ctx)
+	acc = Account{}
+	if err := lenient.Load(&acc, id); err != nil {
+		t.Fatalf("Expected lenient Load to succeed, got %v", err)
+	}
+	if acc.NationalID != "" || acc.Note != "" {
+		t.Errorf("Expected undecryptable fields to be zeroed, got %+v", acc)
+	}
+	if len(reported) != 2 {
+		t.Errorf("Expected 2 reported fields, got %v", reported)
+	}
+
+	// مسیرهای نوشتن حتی در حالت پیش‌فرض مقدار صفرشده را ذخیره نمی‌کنند.
+	if _, err := lenient.UpdateFields(&Account{}, id, map[string]any{"note": "overwritten"}); !errors.As(err, &derr) {
+		t.Errorf("Expected *DecryptError from UpdateFields, got %v", err)
+	}
+	if _, err := lenient.Edit(&Account{}, id, nil); !errors.As(err, &derr) {
+		t.Errorf("Expected *DecryptError from Edit, got %v", err)
+	}
+	repo := must(redisorm.NewRepo[Account](lenientClient))
+	if _, err := repo.Update(ctx, id, map[string]any{"note": "overwritten"}); !errors.As(err, &derr) {
+		t.Errorf("Expected *DecryptError from Repo.Update, got %v", err)
+	}
+	if err := repo.Transaction(ctx, id, func(*Account) error { return nil }); !errors.As(err, &derr) {
+		t.Errorf("Expected *DecryptError from Transaction, got %v", err)
+	}
+	acc = Account{}
+	if err := writer.Load(&acc, id); err != nil || acc.Note != "secret note" {
+		t.Errorf("Expected the stored record to be untouched, got %+v (err: %v)", acc, err)
+	}
+
+	// Repair رکورد رمزگشایی‌نشده را فقط گزارش می‌کند و ایندکس آن را دست نمی‌زند.
+	report, err := lenientClient.Repair(ctx, &Account{})
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if report.Count(redisorm.IssueUndecryptable) != 1 || report.Repaired != 0 {
+		t.Errorf("Expected one undecryptable record and no repairs, got %v (%d repaired)", report.Issues, report.Repaired)
+	}
+	if keys := rdb.Keys(ctx, ns+":idxenc:Account:*").Val(); len(keys) != 1 || rdb.SCard(ctx, keys[0]).Val() != 1 {
+		t.Errorf("Expected the index_enc entry to be kept, got %v", keys)
+	}
+}
+
+func TestCiphertextBinding(t *testing.T) {
+	ns := fmt.Sprintf("test_aad_%d", time.Now().UnixNano())
+	key := []byte("0123456789abcdef0123456789abcdef")
+	sess := newClientInNamespace(t, ns, redisorm.WithMasterKey(key), redisorm.WithStrictDecryption()).WithContext(ctx)
+
+	alice, err := sess.Save(&Account{NationalID: "111", Note: "alice"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	bob, err := sess.Save(&Account{NationalID: "222", Note: "bob"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	readDoc := func(id string) map[string]string {
+		raw, err := rdb.Get(ctx, fmt.Sprintf("%s:val:Account:%s", ns, id)).Result()
+		if err != nil {
+			t.Fatalf("GET failed: %v", err)
+		}
+		var doc map[string]string
+		if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+			t.Fatalf("invalid stored doc: %v", err)
+		}
+		return doc
+	}
+	writeDoc := func(id string, doc map[string]string) {
+		bs, _ := json.Marshal(doc)
+		if err := rdb.Set(ctx, fmt.Sprintf("%s:val:Account:%s", ns, id), bs, 0).Err(); err != nil {
+			t.Fatalf("SET failed: %v", err)
+		}
+	}
+
+	aliceDoc, bobDoc := readDoc(alice), readDoc(bob)
+	if !strings.HasPrefix(aliceDoc["note"], "encf:v2:gcm:") {
+		t.Fatalf("Expected v2 ciphertext, got %s", aliceDoc["note"])
+	}
+
+	// جابجایی ciphertext بین دو رکورد
+	bobDoc["note"] = aliceDoc["note"]
+	writeDoc(bob, bobDoc)
+	var acc Account
+	var derr *redisorm.DecryptError
+	if err := sess.Load(&acc, bob); !errors.As(err, &derr) {
+		t.Errorf("Expected swapped ciphertext to be rejected, got %+v (err: %v)", acc, err)
+	}
+
+	// جابجایی ciphertext بین دو فیلد یک رکورد
+	aliceDoc["national_id"] = aliceDoc["note"]
+	writeDoc(alice, aliceDoc)
+	if err := sess.Load(&acc, alice); !errors.As(err, &derr) || derr.Field != "NationalID" {
+		t.Errorf("Expected field swap to be rejected, got %v", err)
+	}
+
+	// مقادیر قدیمی v1 (بدون AAD) همچنان خوانده می‌شوند
+	gcm, _ := cipher.NewGCM(must(aes.NewCipher(key)))
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	legacy := "encf:v1:gcm:default:" + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("legacy"), nil))
+	writeDoc(alice, map[string]string{"id": alice, "national_id": "", "note": legacy})
+	acc = Account{}
+	if err := sess.Load(&acc, alice); err != nil || acc.Note != "legacy" {
+		t.Fatalf("Expected v1 ciphertext to be readable, got %q (err: %v)", acc.Note, err)
+	}
+
+	if err := sess.Delete(&Account{}, bob); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := sess.RotateKeys(&Account{}); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if note := readDoc(alice)["note"]; !strings.HasPrefix(note, "encf:v2:gcm:default:") {
+		t.Errorf("Expected RotateKeys to upgrade v1 ciphertext, got %s", note)
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestKeyDerivation(t *testing.T) {
+	ns := fmt.Sprintf("test_hkdf_%d", time.Now().UnixNano())
+	masterKey := redisorm.WithMasterKey([]byte("0123456789abcdef0123456789abcdef"))
+
+	legacy := newClientInNamespace(t, ns, masterKey).WithContext(ctx)
+	id, err := legacy.Save(&Account{NationalID: "777", Note: "before"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	client := newClientInNamespace(t, ns, masterKey, redisorm.WithKeyDerivation(), redisorm.WithStrictDecryption())
+	sess := client.WithContext(ctx)
+	var acc Account
+	if err := sess.Load(&acc, id); err != nil || acc.Note != "before" {
+		t.Fatalf("Expected existing data to stay readable, got %q (err: %v)", acc.Note, err)
+	}
+	if n, err := client.RotateKeys(ctx, &Account{}); err != nil || n != 1 {
+		t.Fatalf("Expected 1 record to be migrated, got %d (err: %v)", n, err)
+	}
+	raw, _ := rdb.Get(ctx, fmt.Sprintf("%s:val:Account:%s", ns, id)).Result()
+	if !strings.Contains(raw, "encf:v3:gcm:") {
+		t.Errorf("Expected derived-key ciphertext after migration, got %s", raw)
+	}
+	ids, _, err := sess.PageIDsByEncIndex(&Account{}, "NationalID", "777", 0, 100)
+	if err != nil || len(ids) != 1 || ids[0] != id {
+		t.Errorf("Expected migrated blind index to find the record, got %v (err: %v)", ids, err)
+	}
+
+	acme := client.WithContext(redisorm.WithTenant(ctx, "acme"))
+	globex := client.WithContext(redisorm.WithTenant(ctx, "globex"))
+	tid, err := acme.Save(&Account{NationalID: "777", Note: "acme only"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	// tenant (base64url) پس از شناسه کلید درج می‌شود تا زیرکلید آن هنگام رمزگشایی انتخاب شود.
+	raw, _ = rdb.Get(ctx, fmt.Sprintf("%s:val:Account:%s", ns, tid)).Result()
+	if !strings.Contains(raw, "encf:v3:gcm:default:YWNtZQ:") {
+		t.Errorf("Expected tenant-derived ciphertext, got %s", raw)
+	}
+	if ids, _, _ := globex.PageIDsByEncIndex(&Account{}, "NationalID", "777", 0, 100); len(ids) != 0 {
+		t.Errorf("Expected tenant blind index to be isolated, got %v", ids)
+	}
+	if ids, _, _ := acme.PageIDsByEncIndex(&Account{}, "NationalID", "777", 0, 100); len(ids) != 1 || ids[0] != tid {
+		t.Errorf("Expected tenant blind index to find its own record, got %v", ids)
+	}
+	acc = Account{}
+	if err := acme.Load(&acc, tid); err != nil || acc.Note != "acme only" {
+		t.Errorf("Expected tenant to read its own record, got %q (err: %v)", acc.Note, err)
+	}
+
+	// tenant رکوردی که ciphertext ندارد (index_enc غیرمحرمانه) هم پس از Repair و RotateKeys حفظ می‌شود.
+	sid, err := acme.Save(&Shop{Name: "acme books"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	rdb.Del(ctx, fmt.Sprintf("%s:shd:Shop:%s", ns, sid))
+	if _, err := client.Repair(ctx, &Shop{}); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if _, err := client.RotateKeys(ctx, &Shop{}); err != nil {
+		t.Fatalf("RotateKeys failed: %v", err)
+	}
+	if report, err := client.Verify(ctx, &Shop{}); err != nil || len(report.Issues) != 0 {
+		t.Errorf("Expected a clean report after Repair and RotateKeys, got %v (err: %v)", report, err)
+	}
+	shops := must(redisorm.NewRepo[Shop](client))
+	if found, _, err := shops.FindByIndex(redisorm.WithTenant(ctx, "acme"), "Name", "acme books", 0, 100); err != nil || len(found) != 1 || found[0].ID != sid {
+		t.Errorf("Expected the tenant shop to stay findable, got %v (err: %v)", found, err)
+	}
+}
+
+// Member مدلی با قید یکتای رمز‌شده است.
+type Member struct {
+	ID    string `json:"id" redis:"pk"`
+	Email string `json:"email" secret:"true" redis:",unique_enc"`
+}
+
+func TestEncryptedUnique(t *testing.T) {
+	ns := fmt.Sprintf("test_uniqenc_%d", time.Now().UnixNano())
+	client := newClientInNamespace(t, ns, redisorm.WithMasterKey([]byte("0123456789abcdef0123456789abcdef")))
+	sess := client.WithContext(ctx)
+
+	id, err := sess.Save(&Member{Email: "alice@x.com"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	keys, err := rdb.Keys(ctx, ns+":*").Result()
+	if err != nil {
+		t.Fatalf("KEYS failed: %v", err)
+	}
+	for _, k := range keys {
+		if strings.Contains(k, "alice@x.com") {
+			t.Errorf("Expected plaintext not to appear in key names, got %s", k)
+		}
+	}
+
+	if _, err := sess.Save(&Member{Email: "alice@x.com"}); err == nil {
+		t.Errorf("Expected unique_enc conflict for a duplicate email")
+	}
+	if found, err := sess.FindByUniqueEnc(&Member{}, "Email", "alice@x.com"); err != nil || found != id {
+		t.Errorf("Expected FindByUniqueEnc to return %s, got %q (err: %v)", id, found, err)
+	}
+
+	repo, err := redisorm.NewRepo[Member](client)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	m, err := repo.FindByUniqueEnc(ctx, "Email", "alice@x.com")
+	if err != nil || m.ID != id || m.Email != "alice@x.com" {
+		t.Fatalf("Expected repo lookup to load the member, got %+v (err: %v)", m, err)
+	}
+
+	m.Email = "alice@y.com"
+	if _, err := repo.Save(ctx, m); err != nil {
+		t.Fatalf("Save with new email failed: %v", err)
+	}
+	if _, err := sess.FindByUniqueEnc(&Member{}, "Email", "alice@x.com"); err != redis.Nil {
+		t.Errorf("Expected old email to be released, got %v", err)
+	}
+	if _, err := sess.Save(&Member{Email: "alice@x.com"}); err != nil {
+		t.Errorf("Expected released email to be reusable, got %v", err)
+	}
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := sess.FindByUniqueEnc(&Member{}, "Email", "alice@y.com"); err != redis.Nil {
+		t.Errorf("Expected Delete to release the unique_enc key, got %v", err)
+	}
+
+	// تا پایان RotateKeys مقدار ثبت‌شده با کلید بازنشسته هم تداخل یکتایی است.
+	rotating := newClientInNamespace(t, ns, redisorm.WithKeyring(
+		redisorm.MasterKey{ID: "k2", Key: []byte("fedcba9876543210fedcba9876543210")},
+		redisorm.MasterKey{ID: "default", Key: []byte("0123456789abcdef0123456789abcdef")},
+	)).WithContext(ctx)
+	if _, err := rotating.Save(&Member{Email: "alice@x.com"}); err == nil {
+		t.Error("Expected unique_enc conflict with a record under the retired key")
+	}
+	if n, err := rotating.RotateKeys(&Member{}); err != nil || n != 1 {
+		t.Fatalf("Expected 1 rotated member, got %d (err: %v)", n, err)
+	}
+	if keys := rdb.Keys(ctx, ns+":uniqenc:*").Val(); len(keys) != 1 {
+		t.Errorf("Expected the retired unique_enc key to be replaced, got %v", keys)
+	}
+	if _, err := rotating.FindByUniqueEnc(&Member{}, "Email", "alice@x.com"); err != nil {
+		t.Errorf("Expected rotated unique_enc key to be found, got %v", err)
+	}
+	if _, err := rotating.Save(&Member{Email: "alice@x.com"}); err == nil {
+		t.Error("Expected unique_enc conflict after rotation")
+	}
+}
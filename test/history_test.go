@@ -0,0 +1,130 @@
+package redisorm_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+)
+
+// Contract سه نسخه آخر خود را نگه می‌دارد.
+type Contract struct {
+	ID      string `json:"id" redis:"pk,history=3"`
+	Version int64  `json:"version" redis:"version"`
+	Status  string `json:"status" redis:",index"`
+	Terms   string `json:"terms" secret:"true"`
+}
+
+func TestHistory(t *testing.T) {
+	orm, ns := setupClient(t)
+
+	for _, terms := range []string{"v1", "v2", "v3"} {
+		if _, err := orm.Save(ctx, &Contract{ID: "k1", Status: "draft", Terms: terms}); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	// نسخه تعیین‌شده در اسکریپت در struct هم قرار می‌گیرد تا SaveOptimistic بعدی تداخل نداشته باشد.
+	c := &Contract{ID: "k1", Status: "draft", Terms: "v4"}
+	if _, err := orm.Save(ctx, c); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if c.Version != 4 {
+		t.Fatalf("Expected Save to set Version 4, got %d", c.Version)
+	}
+	if _, err := orm.SaveOptimistic(ctx, c); err != nil {
+		t.Fatalf("SaveOptimistic after Save failed: %v", err)
+	}
+	if _, err := orm.UpdateFieldsFast(ctx, &Contract{}, "k1", map[string]any{"status": "signed"}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+
+	history, err := orm.History(ctx, &Contract{}, "k1")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	var versions []int64
+	for _, h := range history {
+		versions = append(versions, h.Version)
+	}
+	if len(versions) != 3 || versions[0] != 6 || versions[2] != 4 {
+		t.Fatalf("Expected versions [6 5 4], got %v", versions)
+	}
+
+	var old Contract
+	if err := orm.LoadVersion(ctx, &old, "k1", 4); err != nil {
+		t.Fatalf("LoadVersion failed: %v", err)
+	}
+	if old.Version != 4 || old.Terms != "v4" || old.Status != "draft" {
+		t.Errorf("Unexpected version 4 %+v", old)
+	}
+	if err := orm.LoadVersion(ctx, &old, "k1", 1); !errors.Is(err, redisorm.ErrVersionNotFound) {
+		t.Errorf("Expected ErrVersionNotFound for a trimmed version, got %v", err)
+	}
+
+	// بازگردانی یک نسخه جدید می‌سازد و ایندکس‌ها را هم برمی‌گرداند.
+	if err := orm.Revert(ctx, &Contract{}, "k1", 4); err != nil {
+		t.Fatalf("Revert failed: %v", err)
+	}
+	var cur Contract
+	if err := orm.Load(ctx, &cur, "k1"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cur.Version != 7 || cur.Terms != "v4" || cur.Status != "draft" {
+		t.Errorf("Unexpected reverted record %+v", cur)
+	}
+	if !rdb.SIsMember(ctx, ns+":idx:Contract:Status:draft", "k1").Val() {
+		t.Error("Expected reverted record to be back in the draft index")
+	}
+
+	if err := orm.Delete(ctx, &Contract{}, "k1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	// تاریخچه پس از حذف باقی می‌ماند و رکورد جدید با همان شناسه نسخه را ادامه می‌دهد.
+	if history, err := orm.History(ctx, &Contract{}, "k1"); err != nil || len(history) != 3 {
+		t.Fatalf("Expected history to outlive the record, got %v (%v)", history, err)
+	}
+	again := &Contract{ID: "k1", Status: "draft", Terms: "v5"}
+	if _, err := orm.Save(ctx, again); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if again.Version != 8 {
+		t.Errorf("Expected version 8 after delete, got %d", again.Version)
+	}
+}
+
+func TestJanitorKeepsHistory(t *testing.T) {
+	orm, ns := setupClient(t)
+	janitor, err := orm.NewJanitor([]any{&Contract{}}, redisorm.WithSweepInterval(0))
+	if err != nil {
+		t.Fatalf("NewJanitor failed: %v", err)
+	}
+	for _, terms := range []string{"v1", "v2"} {
+		if _, err := orm.Save(ctx, &Contract{ID: "k2", Status: "draft", Terms: terms}, time.Second); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	time.Sleep(1500 * time.Millisecond)
+
+	if n, err := janitor.Sweep(ctx); err != nil || n != 1 {
+		t.Fatalf("Expected 1 reaped record, got %d (%v)", n, err)
+	}
+	if rdb.SIsMember(ctx, ns+":idx:Contract:Status:draft", "k2").Val() {
+		t.Error("Expected index entry of expired record to be removed")
+	}
+	if history, err := orm.History(ctx, &Contract{}, "k2"); err != nil || len(history) != 2 {
+		t.Fatalf("Expected history of expired record to be kept, got %v (%v)", history, err)
+	}
+
+	// رکوردی که دوباره ساخته شود شماره نسخه را پس از تاریخچه ادامه می‌دهد.
+	if _, err := orm.Save(ctx, &Contract{ID: "k2", Status: "draft", Terms: "v3"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	var cur Contract
+	if err := orm.Load(ctx, &cur, "k2"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cur.Version != 3 {
+		t.Errorf("Expected version 3 after the kept history, got %d", cur.Version)
+	}
+}
@@ -0,0 +1,84 @@
+package redisorm_test
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// Invoice مدلی با کلید عددی خودافزاینده و یک شماره مرتب‌شونده ULID است.
+type Invoice struct {
+	ID     int64  `json:"id" redis:"pk" default:"seq"`
+	Number string `json:"number" default:"ulid"`
+	Ref    uint64 `json:"ref" default:"snowflake"`
+}
+
+// Coupon کلید اصلی خود را با IDGenerator می‌سازد.
+type Coupon struct {
+	Code string `json:"code" redis:"pk"`
+}
+
+func (c *Coupon) NewID(ctx context.Context) (string, error) { return "CPN-0001", nil }
+
+func TestIDStrategies(t *testing.T) {
+	orm, _ := setupClient(t)
+	if err := orm.Register(&Invoice{}, &Coupon{}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	var numbers []string
+	refs := map[uint64]bool{}
+	for i := 1; i <= 5; i++ {
+		inv := &Invoice{}
+		id, err := orm.Save(ctx, inv)
+		if err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+		if inv.ID != int64(i) || id != strconv.Itoa(i) {
+			t.Errorf("Expected sequential id %d, got %d (%s)", i, inv.ID, id)
+		}
+		if len(inv.Number) != 26 {
+			t.Errorf("Expected 26-char ULID, got %q", inv.Number)
+		}
+		if inv.Ref == 0 || refs[inv.Ref] {
+			t.Errorf("Expected unique snowflake, got %d", inv.Ref)
+		}
+		refs[inv.Ref] = true
+		numbers = append(numbers, inv.Number)
+	}
+	if !sort.StringsAreSorted(numbers) {
+		t.Errorf("Expected ULIDs in generation order, got %v", numbers)
+	}
+
+	// مقدار تنظیم‌شده دستی بازنویسی نمی‌شود.
+	if _, err := orm.Save(ctx, &Invoice{ID: 100, Number: "manual"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	var manual Invoice
+	if err := orm.Load(ctx, &manual, int64(100)); err != nil || manual.Number != "manual" {
+		t.Errorf("Expected manual invoice, got %+v (err: %v)", manual, err)
+	}
+	// ترتیب از شناسه دستی جلو می‌افتد، پس شناسه‌های بعدی آن را بازنویسی نمی‌کنند.
+	if _, err := orm.Save(ctx, &Invoice{ID: 3, Number: "older"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	next := &Invoice{}
+	if _, err := orm.Save(ctx, next); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if next.ID != 101 {
+		t.Errorf("Expected the sequence to continue after manual id 100, got %d", next.ID)
+	}
+	if err := orm.Load(ctx, &manual, int64(100)); err != nil || manual.Number != "manual" {
+		t.Errorf("Expected manual invoice to survive, got %+v (err: %v)", manual, err)
+	}
+
+	coupon := &Coupon{}
+	if _, err := orm.Save(ctx, coupon); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if coupon.Code != "CPN-0001" {
+		t.Errorf("Expected IDGenerator id CPN-0001, got %q", coupon.Code)
+	}
+}
@@ -0,0 +1,529 @@
+package redisorm_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+)
+
+// Subscriber مدلی با ایندکس و قید یکتا برای تست پاک‌سازی رکوردهای منقضی‌شده است.
+type Subscriber struct {
+	ID    string `json:"id" redis:"pk"`
+	Email string `json:"email" redis:",unique"`
+	Plan  string `json:"plan" redis:",index"`
+}
+
+// Customer مدلی با چند فیلد ایندکس‌شده برای تست پرس‌وجوها است.
+type Customer struct {
+	ID      string `json:"id" redis:"pk"`
+	Country string `json:"country" redis:",index"`
+	Status  string `json:"status" redis:",index"`
+}
+
+func TestQuery(t *testing.T) {
+	orm, _ := setupClient(t)
+	repo, err := redisorm.NewRepo[Customer](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+
+	for _, c := range []*Customer{
+		{ID: "c1", Country: "IR", Status: "active"},
+		{ID: "c2", Country: "IR", Status: "blocked"},
+		{ID: "c3", Country: "DE", Status: "active"},
+		{ID: "c4", Country: "US", Status: "active"},
+	} {
+		if _, err := repo.Save(ctx, c); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		q    *redisorm.Query[Customer]
+		want []string
+	}{
+		{"And", repo.Where("Country", "IR").And("Status", "active"), []string{"c1"}},
+		{"Or", repo.Where("Country", "IR").Or("Country", "DE"), []string{"c1", "c2", "c3"}},
+		{"Not", repo.Where("Status", "active").Not("Country", "US"), []string{"c1", "c3"}},
+		{"Paged", repo.Where("Status", "active").Offset(1).Limit(1), []string{"c3"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			found, err := tc.q.Find(ctx)
+			if err != nil {
+				t.Fatalf("Find failed: %v", err)
+			}
+			if len(found) != len(tc.want) {
+				t.Fatalf("Expected %d results, got %d", len(tc.want), len(found))
+			}
+			for i, c := range found {
+				if c.ID != tc.want[i] {
+					t.Errorf("Result %d: expected %s, got %s", i, tc.want[i], c.ID)
+				}
+			}
+		})
+	}
+
+	n, err := repo.Where("Status", "active").Count(ctx)
+	if err != nil || n != 3 {
+		t.Errorf("Expected count 3, got %d (err: %v)", n, err)
+	}
+
+	// فیلد بدون ایندکس (یا اشتباه تایپی) به جای نتیجه خالی خطا می‌دهد.
+	if _, err := repo.Where("Status", "active").And("Contry", "IR").IDs(ctx); err == nil {
+		t.Error("Expected error for a condition on a field that is not indexed")
+	}
+	if _, err := repo.Where("ID", "c1").Count(ctx); err == nil {
+		t.Error("Expected error for a condition on the primary key")
+	}
+}
+
+// Order مدلی با ایندکس‌های بازه‌ای روی فیلد عددی و زمانی است.
+type Order struct {
+	ID        string    `json:"id" redis:"pk"`
+	Amount    float64   `json:"amount" redis:",range"`
+	CreatedAt time.Time `json:"created_at" redis:",range"`
+}
+
+func TestFindRange(t *testing.T) {
+	orm, _ := setupClient(t)
+	repo, err := redisorm.NewRepo[Order](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+
+	now := time.Now()
+	for _, o := range []*Order{
+		{ID: "o1", Amount: 50, CreatedAt: now.Add(-3 * time.Hour)},
+		{ID: "o2", Amount: 150, CreatedAt: now.Add(-30 * time.Minute)},
+		{ID: "o3", Amount: 250, CreatedAt: now.Add(-10 * time.Minute)},
+	} {
+		if _, err := repo.Save(ctx, o); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	recent, err := repo.FindRange(ctx, "CreatedAt", now.Add(-time.Hour), nil, 0)
+	if err != nil {
+		t.Fatalf("FindRange by time failed: %v", err)
+	}
+	if len(recent) != 2 || recent[0].ID != "o2" || recent[1].ID != "o3" {
+		t.Errorf("Expected o2 and o3 in the last hour, got %d results", len(recent))
+	}
+
+	big, err := repo.FindRange(ctx, "Amount", "(100", nil, 1)
+	if err != nil {
+		t.Fatalf("FindRange by amount failed: %v", err)
+	}
+	if len(big) != 1 || big[0].ID != "o2" {
+		t.Errorf("Expected only o2 with limit 1, got %d results", len(big))
+	}
+	if ids, err := orm.PageIDsByRange(ctx, &Order{}, "Amount", nil, nil, 0, 0); err != nil || len(ids) != 0 {
+		t.Errorf("Expected count 0 to return no ids, got %v (err: %v)", ids, err)
+	}
+	if ids, err := orm.PageIDsByRange(ctx, &Order{}, "Amount", nil, nil, 1, -1); err != nil || len(ids) != 2 {
+		t.Errorf("Expected a negative count to return all ids after the offset, got %v (err: %v)", ids, err)
+	}
+
+	if err := repo.Delete(ctx, "o2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	big, _ = repo.FindRange(ctx, "Amount", 100, nil, 0)
+	if len(big) != 1 || big[0].ID != "o3" {
+		t.Errorf("Expected deleted record to be removed from the range index")
+	}
+}
+
+// Ticket مدلی با فیلد sortable برای تست مرتب‌سازی و صفحه‌بندی است.
+type Ticket struct {
+	ID       string `json:"id" redis:"pk"`
+	Status   string `json:"status" redis:",index"`
+	Priority int    `json:"priority" redis:",sortable"`
+}
+
+func TestSortedPagination(t *testing.T) {
+	orm, _ := setupClient(t)
+	repo, err := redisorm.NewRepo[Ticket](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	for _, tk := range []*Ticket{
+		{ID: "t1", Status: "open", Priority: 3},
+		{ID: "t2", Status: "open", Priority: 1},
+		{ID: "t3", Status: "open", Priority: 3},
+		{ID: "t4", Status: "open", Priority: 2},
+		{ID: "t5", Status: "closed", Priority: 9},
+	} {
+		if _, err := repo.Save(ctx, tk); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	var got []string
+	token := ""
+	for {
+		page, next, err := repo.Where("Status", "open").OrderBy(redisorm.Desc).Limit(2).After(token).Page(ctx)
+		if err != nil {
+			t.Fatalf("Page failed: %v", err)
+		}
+		for _, tk := range page {
+			got = append(got, tk.ID)
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	want := []string{"t3", "t1", "t4", "t2"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+
+	// توکن پس از حذف رکورد آخر صفحه و میان امتیازهای تکراری هم معتبر می‌ماند.
+	for i := range 250 {
+		if _, err := repo.Save(ctx, &Ticket{ID: fmt.Sprintf("tie%03d", i), Status: "tied", Priority: 7}); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	first, next, err := repo.Where("Status", "tied").OrderBy(redisorm.Asc).Limit(120).Page(ctx)
+	if err != nil || len(first) != 120 || next == "" {
+		t.Fatalf("Expected a full first page, got %d (err: %v)", len(first), err)
+	}
+	if err := repo.Delete(ctx, "tie119"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	rest, err := repo.Where("Status", "tied").OrderBy(redisorm.Asc).After(next).IDs(ctx)
+	if err != nil {
+		t.Fatalf("IDs after token failed: %v", err)
+	}
+	if len(rest) != 130 || rest[0] != "tie120" || rest[129] != "tie249" {
+		t.Errorf("Expected tie120..tie249 after the token, got %d ids starting with %v", len(rest), rest[:min(len(rest), 1)])
+	}
+	if _, err := repo.Where("Status", "tied").OrderBy(redisorm.Asc).After(next).Offset(5).IDs(ctx); err == nil {
+		t.Error("Expected Offset with After to be rejected")
+	}
+
+	sess := orm.WithContext(ctx)
+	ids, _, err := sess.PageIDsByIndexSorted(&Ticket{}, "Status", "open", redisorm.Asc, "", 2)
+	if err != nil {
+		t.Fatalf("PageIDsByIndexSorted failed: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "t2" || ids[1] != "t4" {
+		t.Errorf("Expected [t2 t4], got %v", ids)
+	}
+}
+
+// BaseModel فیلدهای مشترک مدل‌ها است که به صورت جاسازی‌شده استفاده می‌شود.
+type BaseModel struct {
+	ID        string    `json:"id" redis:"pk"`
+	Version   int64     `json:"version" redis:"version"`
+	CreatedAt time.Time `json:"created_at" redis:",auto_create_time"`
+}
+
+type Address struct {
+	City string `json:"city" redis:",index"`
+	Zip  string `json:"zip"`
+}
+
+// Shop مدلی با struct جاسازی‌شده و ایندکس روی فیلد تودرتو است.
+type Shop struct {
+	BaseModel
+	Name    string    `json:"name" redis:",index_enc"`
+	Address Address   `json:"address"`
+	Label   string    `json:"-," redis:",index"`           // نام JSON آن "-" است
+	Touched time.Time `json:"-" redis:",auto_update_time"` // مانند encoding/json نادیده گرفته می‌شود
+}
+
+func TestEmbeddedAndNestedFields(t *testing.T) {
+	orm, ns := setupClient(t)
+	repo, err := redisorm.NewRepo[Shop](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	if err := orm.Register(&Shop{}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	shop := &Shop{BaseModel: BaseModel{ID: "s1"}, Name: "Kiosk", Address: Address{City: "Tabriz", Zip: "51"}, Label: "corner"}
+	if _, err := repo.SaveOptimistic(ctx, shop); err != nil {
+		t.Fatalf("SaveOptimistic failed: %v", err)
+	}
+	if shop.Version != 1 || shop.CreatedAt.IsZero() {
+		t.Errorf("Expected embedded version and created_at to be set, got %d, %v", shop.Version, shop.CreatedAt)
+	}
+	if _, err := repo.Save(ctx, &Shop{BaseModel: BaseModel{ID: "s2"}, Address: Address{City: "Shiraz"}}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := repo.Load(ctx, "s1")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.ID != "s1" || loaded.Address.City != "Tabriz" || loaded.Version != 1 {
+		t.Errorf("Unexpected loaded shop: %+v", loaded)
+	}
+
+	found, err := repo.Where("Address.City", "Tabriz").Find(ctx)
+	if err != nil || len(found) != 1 || found[0].ID != "s1" {
+		t.Fatalf("Expected s1 by Address.City, got %v (err: %v)", found, err)
+	}
+
+	// index_enc نباید کلید ایندکس ساده بسازد.
+	if n, err := repo.Where("Name", "Kiosk").Count(ctx); err != nil || n != 1 {
+		t.Errorf("Expected 1 shop by encrypted name, got %d (err: %v)", n, err)
+	}
+	if shops, _, err := repo.FindByIndex(ctx, "Name", "Kiosk", 0, 10); err != nil || len(shops) != 1 || shops[0].ID != "s1" {
+		t.Errorf("Expected FindByIndex to find s1 by encrypted name, got %v (err: %v)", shops, err)
+	}
+	if ids, _, err := orm.PageIDsByIndex(ctx, &Shop{}, "Name", "Kiosk", 0, 10); err == nil && len(ids) > 0 {
+		t.Errorf("index_enc field must not have a plain index, got %v", ids)
+	}
+
+	if n, err := repo.Where("Label", "corner").Count(ctx); err != nil || n != 1 {
+		t.Errorf("Expected 1 shop by the field named \"-\" in JSON, got %d (err: %v)", n, err)
+	}
+	if _, err := orm.UpdateFieldsFast(ctx, &Shop{}, "s2", map[string]any{"name": "Stall"}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	if raw := rdb.Get(ctx, ns+":val:Shop:s2").Val(); strings.Contains(raw, "Touched") {
+		t.Errorf("Expected a json:\"-\" field to be skipped, got %s", raw)
+	}
+
+	loaded.Address.City = "Tehran"
+	if _, err := repo.SaveOptimistic(ctx, loaded); err != nil {
+		t.Fatalf("SaveOptimistic failed: %v", err)
+	}
+	if n, _ := repo.Where("Address.City", "Tabriz").Count(ctx); n != 0 {
+		t.Errorf("Expected old nested index entry to be removed, got %d", n)
+	}
+}
+
+func TestIndexShadow(t *testing.T) {
+	orm, ns := setupClient(t)
+	repo, err := redisorm.NewRepo[Customer](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+
+	// ذخیره‌های همزمان یک رکورد نباید ورودی ایندکس کهنه باقی بگذارند.
+	countries := []string{"IR", "DE", "US", "FR", "TR", "JP", "BR", "CA"}
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := repo.Save(ctx, &Customer{ID: "race", Country: countries[i%len(countries)], Status: "active"}); err != nil {
+				t.Errorf("Save failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	final, err := repo.Load(ctx, "race")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, country := range countries {
+		n, err := repo.Where("Country", country).Count(ctx)
+		if err != nil {
+			t.Fatalf("Count failed: %v", err)
+		}
+		if want := map[bool]int64{true: 1, false: 0}[country == final.Country]; n != want {
+			t.Errorf("Country %s: expected %d indexed records, got %d", country, want, n)
+		}
+	}
+
+	// رکوردی که پیش از معرفی shadowها نوشته شده است.
+	rdb.Set(ctx, ns+":val:Customer:legacy", `{"id":"legacy","country":"IR","status":"blocked"}`, 0)
+	rdb.SAdd(ctx, ns+":idx:Customer:Country:IR", "legacy")
+	rdb.SAdd(ctx, ns+":idx:Customer:Status:blocked", "legacy")
+	if _, err := repo.Save(ctx, &Customer{ID: "legacy", Country: "DE", Status: "blocked"}); err != nil {
+		t.Fatalf("Save of legacy record failed: %v", err)
+	}
+	if rdb.SIsMember(ctx, ns+":idx:Customer:Country:IR", "legacy").Val() {
+		t.Error("Expected legacy IR index entry to be removed")
+	}
+	if !rdb.SIsMember(ctx, ns+":idx:Customer:Country:DE", "legacy").Val() {
+		t.Error("Expected legacy record in DE index")
+	}
+	if err := repo.Delete(ctx, "legacy"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if n := rdb.Exists(ctx, ns+":idx:Customer:Status:blocked", ns+":shd:Customer:legacy").Val(); n != 0 {
+		t.Errorf("Expected index and shadow keys to be removed on delete, %d remain", n)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	orm, ns := setupClient(t)
+	repo, err := redisorm.NewRepo[Subscriber](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	janitor, err := orm.NewJanitor([]any{&Subscriber{}}, redisorm.WithSweepInterval(0))
+	if err != nil {
+		t.Fatalf("NewJanitor failed: %v", err)
+	}
+
+	if _, err := repo.Save(ctx, &Subscriber{ID: "m1", Email: "a@example.com", Plan: "pro"}, time.Second); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := repo.Save(ctx, &Subscriber{ID: "m2", Email: "b@example.com", Plan: "pro"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+
+	// اسکریپت‌ها روی سروری که کش آن خالی است هم باید اجرا شوند.
+	if err := rdb.ScriptFlush(ctx).Err(); err != nil {
+		t.Fatalf("SCRIPT FLUSH failed: %v", err)
+	}
+	n, err := janitor.Sweep(ctx)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 reaped record, got %d", n)
+	}
+	if ids := rdb.SMembers(ctx, ns+":idx:Subscriber:Plan:pro").Val(); len(ids) != 1 || ids[0] != "m2" {
+		t.Errorf("Expected only m2 in the plan index, got %v", ids)
+	}
+	if n := rdb.Exists(ctx, ns+":ver:Subscriber:m1", ns+":shd:Subscriber:m1").Val(); n != 0 {
+		t.Errorf("Expected version and shadow keys of expired record to be removed, %d remain", n)
+	}
+	if _, err := repo.Save(ctx, &Subscriber{ID: "m3", Email: "a@example.com", Plan: "free"}); err != nil {
+		t.Errorf("Expected email of expired record to be free again, got %v", err)
+	}
+
+	// با فعال بودن keyspace notifications، Run بدون پیمایش دوره‌ای پاک‌سازی می‌کند.
+	if err := rdb.ConfigSet(ctx, "notify-keyspace-events", "Ex").Err(); err != nil {
+		t.Skipf("cannot enable keyspace notifications: %v", err)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go janitor.Run(runCtx)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := repo.Save(ctx, &Subscriber{ID: "m4", Email: "c@example.com", Plan: "trial"}, 200*time.Millisecond); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for rdb.Exists(ctx, ns+":uniq:Subscriber:Email:c@example.com").Val() == 1 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	if rdb.Exists(ctx, ns+":uniq:Subscriber:Email:c@example.com", ns+":idx:Subscriber:Plan:trial").Val() != 0 {
+		t.Error("Expected Run to remove index and unique keys of the expired record")
+	}
+}
+
+func TestVerifyRepair(t *testing.T) {
+	orm, ns := setupClient(t)
+	repo, err := redisorm.NewRepo[Subscriber](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	for _, s := range []Subscriber{
+		{ID: "s1", Email: "a@example.com", Plan: "pro"},
+		{ID: "s2", Email: "b@example.com", Plan: "free"},
+	} {
+		if _, err := repo.Save(ctx, &s); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	if report, err := orm.Verify(ctx, &Subscriber{}); err != nil || len(report.Issues) != 0 || report.Records != 2 {
+		t.Fatalf("Expected a clean report for 2 records, got %+v, %v", report, err)
+	}
+
+	// خرابی‌های دستی: عضو بدون رکورد، ورودی جاافتاده، کلید یکتای کهنه و shadow حذف‌شده.
+	rdb.SAdd(ctx, ns+":idx:Subscriber:Plan:pro", "ghost")
+	rdb.SRem(ctx, ns+":idx:Subscriber:Plan:free", "s2")
+	rdb.Set(ctx, ns+":uniq:Subscriber:Email:a@example.com", "ghost", 0)
+	rdb.Del(ctx, ns+":shd:Subscriber:s2")
+
+	report, err := orm.Verify(ctx, &Subscriber{})
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if d, m, s := report.Count(redisorm.IssueDangling), report.Count(redisorm.IssueMissing), report.Count(redisorm.IssueShadow); d != 2 || m != 2 || s != 1 {
+		t.Errorf("Expected 2 dangling, 2 missing and 1 shadow issues, got %d, %d, %d: %v", d, m, s, report.Issues)
+	}
+	if !rdb.SIsMember(ctx, ns+":idx:Subscriber:Plan:pro", "ghost").Val() {
+		t.Error("Verify must not change anything")
+	}
+
+	report, err = orm.Repair(ctx, &Subscriber{})
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if report.Repaired == 0 {
+		t.Error("Expected Repair to fix the issues")
+	}
+	if report, err := orm.Verify(ctx, &Subscriber{}); err != nil || len(report.Issues) != 0 {
+		t.Errorf("Expected a clean report after Repair, got %v, %v", report.Issues, err)
+	}
+	if owner := rdb.Get(ctx, ns+":uniq:Subscriber:Email:a@example.com").Val(); owner != "s1" {
+		t.Errorf("Expected unique key to point at s1, got %q", owner)
+	}
+	if ids, _ := repo.Where("Plan", "free").IDs(ctx); len(ids) != 1 || ids[0] != "s2" {
+		t.Errorf("Expected s2 back in the free plan index, got %v", ids)
+	}
+
+	var out bytes.Buffer
+	if err := orm.IndexCommand(ctx, []string{"-model", "Subscriber"}, &out, &Subscriber{}); err != nil {
+		t.Errorf("IndexCommand failed: %v\n%s", err, out.String())
+	}
+}
+
+func TestUniqueReclaim(t *testing.T) {
+	orm, ns := setupClient(t)
+	repo, err := redisorm.NewRepo[Subscriber](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	uniqKey := func(email string) string { return ns + ":uniq:Subscriber:Email:" + email }
+
+	// کلید یکتا TTL رکورد را به ارث می‌برد.
+	if _, err := repo.Save(ctx, &Subscriber{ID: "otp", Email: "otp@example.com"}, 5*time.Second); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if ttl := rdb.PTTL(ctx, uniqKey("otp@example.com")).Val(); ttl <= 0 || ttl > 5*time.Second {
+		t.Errorf("Expected unique key to expire with its record, got %v", ttl)
+	}
+	if err := orm.Touch(ctx, &Subscriber{}, "otp", time.Minute); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	if ttl := rdb.PTTL(ctx, uniqKey("otp@example.com")).Val(); ttl <= 5*time.Second {
+		t.Errorf("Expected Touch to extend the unique key, got %v", ttl)
+	}
+	if _, err := repo.Save(ctx, &Subscriber{ID: "otp", Email: "otp@example.com"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if ttl := rdb.PTTL(ctx, uniqKey("otp@example.com")).Val(); ttl != -1 {
+		t.Errorf("Expected unique key without TTL after saving without TTL, got %v", ttl)
+	}
+
+	// مالک زنده همچنان مانع مقدار تکراری است.
+	if _, err := repo.Save(ctx, &Subscriber{ID: "other", Email: "otp@example.com"}); err == nil {
+		t.Error("Expected unique constraint violation")
+	}
+
+	// کلید یکتای رکوردی که بیرون از ORM حذف شده است بازپس گرفته می‌شود.
+	rdb.Del(ctx, ns+":val:Subscriber:otp")
+	if _, err := repo.Save(ctx, &Subscriber{ID: "other", Email: "otp@example.com"}); err != nil {
+		t.Fatalf("Expected stale unique key to be taken over, got %v", err)
+	}
+	if owner := rdb.Get(ctx, uniqKey("otp@example.com")).Val(); owner != "other" {
+		t.Errorf("Expected unique key to point at the new owner, got %q", owner)
+	}
+}
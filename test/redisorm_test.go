@@ -2,7 +2,9 @@ package redisorm_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
 
@@ -145,6 +147,113 @@ func TestTagsAndHooks(t *testing.T) {
 	})
 }
 
+func TestUpdateFieldsFast(t *testing.T) {
+	orm, ns := setupClient(t)
+	sess := orm.WithContext(ctx)
+
+	u := &User{Email: "fast@example.com", Country: "IR"}
+	id, err := sess.Save(u, time.Hour)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := sess.Save(&User{Email: "taken@example.com", Country: "IR"}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	changed, err := sess.UpdateFieldsFast(&User{}, id, map[string]any{"country": "DE", "email": "fast@example.com"})
+	if err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	// email رمز می‌شود و همیشه تغییرکرده محسوب می‌شود.
+	if !slices.Contains(changed, "country") {
+		t.Errorf("Expected country in changed fields, got %v", changed)
+	}
+
+	ids, _, err := sess.PageIDsByIndex(&User{}, "Country", "DE", 0, 10)
+	if err != nil || len(ids) != 1 || ids[0] != id {
+		t.Errorf("Expected %s in DE index, got %v (err: %v)", id, ids, err)
+	}
+	ids, _, _ = sess.PageIDsByIndex(&User{}, "Country", "IR", 0, 10)
+	if slices.Contains(ids, id) {
+		t.Errorf("Expected %s to be removed from IR index", id)
+	}
+	if ttl := rdb.PTTL(ctx, fmt.Sprintf("%s:val:User:%s", ns, id)).Val(); ttl <= 0 {
+		t.Errorf("Expected TTL to be kept, got %v", ttl)
+	}
+
+	var loaded User
+	if err := sess.Load(&loaded, id); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Version != 1 || !loaded.UpdatedAt.After(u.UpdatedAt) || loaded.Email != "fast@example.com" {
+		t.Errorf("Expected version 1, newer updated_at and decrypted email, got %+v", loaded)
+	}
+
+	if changed, err := sess.UpdateFieldsFast(&User{}, id, map[string]any{"country": "DE"}); err != nil || len(changed) != 0 {
+		t.Errorf("Expected no changes, got %v (err: %v)", changed, err)
+	}
+	if _, err := sess.UpdateFieldsFast(&User{}, id, map[string]any{"country": "US"}, redisorm.ExpectVersion(0)); !errors.Is(err, redisorm.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict, got %v", err)
+	}
+	if _, err := sess.UpdateFieldsFast(&User{}, id, map[string]any{"email": "taken@example.com"}); err == nil {
+		t.Error("Expected unique constraint violation")
+	}
+	if _, err := sess.UpdateFieldsFast(&User{}, id, map[string]any{"country": "US"}, redisorm.ExpectVersion(1)); err != nil {
+		t.Errorf("UpdateFieldsFast with matching version failed: %v", err)
+	}
+	if _, err := sess.UpdateFieldsFast(&User{}, "missing", map[string]any{"country": "US"}); !errors.Is(err, redis.Nil) {
+		t.Errorf("Expected redis.Nil for a missing record, got %v", err)
+	}
+}
+
+// Ledger مقادیر بزرگ‌تر از 2^53 و slice خالی دارد که UpdateFieldsFast باید دست‌نخورده نگه دارد.
+type Ledger struct {
+	ID      string   `json:"id" redis:"pk"`
+	Version int64    `json:"version" redis:"version"`
+	Balance int64    `json:"balance"`
+	Tags    []string `json:"tags"`
+	Note    string   `json:"note"`
+}
+
+func TestUpdateFieldsFastPreservesJSON(t *testing.T) {
+	orm, ns := setupClient(t)
+	const big = int64(1)<<62 + 1
+
+	l := &Ledger{ID: "l1", Balance: big, Tags: []string{}}
+	if _, err := orm.SaveOptimistic(ctx, l); err != nil {
+		t.Fatalf("SaveOptimistic failed: %v", err)
+	}
+	if _, err := orm.SaveOptimistic(ctx, l); err != nil {
+		t.Fatalf("SaveOptimistic failed: %v", err)
+	}
+	// بدون شمارنده نسخه، نسخه از مقدار ذخیره‌شده در سند ادامه می‌یابد.
+	rdb.Del(ctx, ns+":ver:Ledger:l1")
+	if _, err := orm.UpdateFieldsFast(ctx, &Ledger{}, "l1", map[string]any{"note": "x"}); err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	var loaded Ledger
+	if err := orm.Load(ctx, &loaded, "l1"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Balance != big || loaded.Tags == nil || len(loaded.Tags) != 0 || loaded.Note != "x" {
+		t.Errorf("Expected balance %d and an empty tags slice, got %+v", big, loaded)
+	}
+	if loaded.Version != 3 {
+		t.Errorf("Expected version 3 after 2 saves, got %d", loaded.Version)
+	}
+
+	changed, err := orm.UpdateFieldsFast(ctx, &Ledger{}, "l1", map[string]any{"balance": big + 2, "tags": []string{}})
+	if err != nil {
+		t.Fatalf("UpdateFieldsFast failed: %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "balance" {
+		t.Errorf("Expected only balance to change, got %v", changed)
+	}
+	if err := orm.Load(ctx, &loaded, "l1"); err != nil || loaded.Balance != big+2 {
+		t.Errorf("Expected balance %d, got %d (err: %v)", big+2, loaded.Balance, err)
+	}
+}
+
 // ... (سایر تست‌های بنچمارک) ...
 
 func BenchmarkTouch(b *testing.B) {
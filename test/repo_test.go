@@ -0,0 +1,160 @@
+package redisorm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+)
+
+func TestRepo(t *testing.T) {
+	orm, _ := setupClient(t)
+
+	repo, err := redisorm.NewRepo[User](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+
+	id, err := repo.Save(ctx, &User{Email: "repo@example.com", Country: "IR"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	u, err := repo.Load(ctx, id)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if u.Email != "repo@example.com" {
+		t.Errorf("Expected decrypted email, got %q", u.Email)
+	}
+
+	found, _, err := repo.FindByIndex(ctx, "Country", "IR", 0, 100)
+	if err != nil {
+		t.Fatalf("FindByIndex failed: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != id {
+		t.Errorf("Expected to find saved user by index, got %d items", len(found))
+	}
+	if _, _, err := repo.FindByIndex(ctx, "Contry", "IR", 0, 100); err == nil {
+		t.Error("Expected error for a field that is not indexed")
+	}
+
+	updated, err := repo.Update(ctx, id, map[string]any{"country": "DE"})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if updated.Country != "DE" {
+		t.Errorf("Expected country DE after update, got %q", updated.Country)
+	}
+
+	errAbort := errors.New("abort")
+	err = repo.Transaction(ctx, id, func(u *User) error {
+		u.Country = "FR"
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("Expected transaction to return callback error, got %v", err)
+	}
+	if err := repo.Transaction(ctx, id, func(u *User) error { u.Country = "US"; return nil }); err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if u, _ = repo.Load(ctx, id); u == nil || u.Country != "US" {
+		t.Errorf("Expected transaction changes to be saved")
+	}
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, _ := repo.Exists(ctx, id); ok {
+		t.Errorf("Expected record to be deleted")
+	}
+}
+
+// Shipment مدلی با کلید اصلی ترکیبی است.
+type Shipment struct {
+	TenantID string `json:"tenant_id" redis:"pk"`
+	OrderNo  int    `json:"order_no" redis:"pk"`
+	Status   string `json:"status" redis:",index"`
+}
+
+func TestCompositeKey(t *testing.T) {
+	orm, _ := setupClient(t)
+	if err := orm.Register(&Shipment{}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	id, err := orm.Save(ctx, &Shipment{TenantID: "acme|eu", OrderNo: 7, Status: "sent"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if id != redisorm.JoinID("acme|eu", 7) {
+		t.Errorf("Unexpected composite id %q", id)
+	}
+	if parts := redisorm.SplitID(id); len(parts) != 2 || parts[0] != "acme|eu" || parts[1] != "7" {
+		t.Errorf("SplitID(%q) = %v", id, parts)
+	}
+	if _, err := orm.Save(ctx, &Shipment{TenantID: "acme|eu", OrderNo: 8}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := orm.Save(ctx, &Shipment{OrderNo: 9}); err == nil {
+		t.Error("Expected error for empty composite key part")
+	}
+	// جزء عددی 0 در کلید ترکیبی مقدار معتبری است.
+	if id, err := orm.Save(ctx, &Shipment{TenantID: "acme|eu", OrderNo: 0, Status: "draft"}); err != nil || id != redisorm.JoinID("acme|eu", 0) {
+		t.Fatalf("Expected order 0 to be saved, got %q (err: %v)", id, err)
+	}
+	if ok, err := orm.Exists(ctx, &Shipment{}, redisorm.Key{"acme|eu", 0}); err != nil || !ok {
+		t.Errorf("Expected shipment 0 to exist, got %v (err: %v)", ok, err)
+	}
+
+	var byKey, byStruct Shipment
+	if err := orm.Load(ctx, &byKey, redisorm.Key{"acme|eu", 7}); err != nil {
+		t.Fatalf("Load by Key failed: %v", err)
+	}
+	byStruct = Shipment{TenantID: "acme|eu", OrderNo: 7}
+	if err := orm.Load(ctx, &byStruct, nil); err != nil {
+		t.Fatalf("Load by struct failed: %v", err)
+	}
+	if byKey.Status != "sent" || byStruct.Status != "sent" {
+		t.Errorf("Expected loaded status sent, got %q and %q", byKey.Status, byStruct.Status)
+	}
+	if err := orm.Load(ctx, &byKey, redisorm.Key{"acme|eu"}); err == nil {
+		t.Error("Expected error for a Key with missing parts")
+	}
+
+	repo, err := redisorm.NewRepo[Shipment](orm)
+	if err != nil {
+		t.Fatalf("NewRepo failed: %v", err)
+	}
+	if ok, err := repo.Exists(ctx, redisorm.Key{"acme|eu", 8}); err != nil || !ok {
+		t.Errorf("Expected shipment 8 to exist, got %v (err: %v)", ok, err)
+	}
+	if err := repo.Delete(ctx, Shipment{TenantID: "acme|eu", OrderNo: 8}); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if ok, _ := orm.Exists(ctx, &Shipment{}, redisorm.Key{"acme|eu", 8}); ok {
+		t.Error("Expected shipment 8 to be deleted")
+	}
+	found, err := repo.Where("Status", "sent").Find(ctx)
+	if err != nil || len(found) != 1 || found[0].OrderNo != 7 {
+		t.Errorf("Expected shipment 7 by index, got %v (err: %v)", found, err)
+	}
+
+	// Update و Transaction هم کلید ترکیبی را مانند Load می‌پذیرند.
+	if _, err := repo.Update(ctx, redisorm.Key{"acme|eu", 7}, map[string]any{"status": "returned"}); err != nil {
+		t.Fatalf("Update by Key failed: %v", err)
+	}
+	err = repo.Transaction(ctx, Shipment{TenantID: "acme|eu", OrderNo: 7}, func(s *Shipment) error {
+		if s.Status != "returned" {
+			t.Errorf("Expected updated status inside transaction, got %q", s.Status)
+		}
+		s.Status = "closed"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction by struct failed: %v", err)
+	}
+	if s, err := repo.Load(ctx, redisorm.Key{"acme|eu", 7}); err != nil || s.Status != "closed" {
+		t.Errorf("Expected status closed after transaction, got %v (err: %v)", s, err)
+	}
+}
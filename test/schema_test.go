@@ -0,0 +1,98 @@
+package redisorm_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrjvadi/Go-RedisOrm/redisorm"
+	"github.com/redis/go-redis/v9"
+)
+
+type BrokenModel struct {
+	Key       []byte    `json:"key" redis:"pk"`
+	Version   int       `json:"version" redis:"version"`
+	Email     string    `json:"email" secret:"true" redis:",unique"`
+	Phone     string    `json:"phone" secret:"yes" redis:",history=many"`
+	Country   string    `json:"country" redis:",indx"`
+	Tier      string    `json:"tier" redis:",unique_x"`
+	Serial    int64     `json:"serial" default:"ulid"`
+	Score     string    `json:"score" redis:",sortable"`
+	CreatedAt string    `json:"created_at" redis:",auto_create_time"`
+	UpdatedAt time.Time `json:"updated_at" redis:",auto_update_time"`
+}
+
+type ValidModel struct {
+	ID        string    `json:"id" redis:"pk"`
+	Version   int64     `json:"version" redis:"version"`
+	Email     string    `json:"email" secret:"true" redis:",unique_enc"`
+	Country   string    `json:"country" redis:",index"`
+	CreatedAt time.Time `json:"created_at" redis:",sortable,auto_create_time"`
+}
+
+type NoPKModel struct {
+	Name string `json:"name"`
+}
+
+// ValidModelCopy همان نام مدل ValidModel را دارد.
+type ValidModelCopy struct {
+	ID string `json:"id" redis:"pk"`
+}
+
+func (ValidModelCopy) ModelName() string { return "ValidModel" }
+
+// Inventory نام مدل را برابر گروه مدل Product قرار می‌دهد.
+type Inventory struct {
+	ID string `json:"id" redis:"pk"`
+}
+
+func (Inventory) ModelName() string { return "inventory" }
+
+func TestRegister(t *testing.T) {
+	client, err := redisorm.New(redis.NewClient(&redis.Options{Addr: "localhost:6379"}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := client.Register(&ValidModel{}); err != nil {
+		t.Fatalf("Expected valid model to register, got %v", err)
+	}
+
+	err = client.Register(&BrokenModel{}, &NoPKModel{}, &ValidModelCopy{}, &Product{}, &Inventory{})
+	var schemaErr *redisorm.SchemaError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("Expected *SchemaError, got %v", err)
+	}
+	for _, want := range []string{
+		"BrokenModel.Key: primary key must be a string or integer",
+		"BrokenModel.Version: version field must be int64",
+		"BrokenModel.Email: secret field with unique leaks plaintext",
+		"BrokenModel.Phone: secret tag must be",
+		`BrokenModel.Phone: redis tag option "history" requires a positive number, got "many"`,
+		`BrokenModel.Country: unknown redis tag option "indx"`,
+		`BrokenModel.Tier: unknown redis tag option "unique_x"`,
+		`BrokenModel.Serial: default:"ulid" requires a string field`,
+		"BrokenModel.Score: range/sortable requires a numeric or time.Time field",
+		"BrokenModel.CreatedAt: auto_create_time/auto_update_time requires a time.Time field",
+		"NoPKModel: no pk field",
+		`model prefix "ValidModel" is already used by`,
+		`Inventory: model prefix "inventory" overlaps "inventory:products"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected schema error to mention %q, got:\n%v", want, err)
+		}
+	}
+
+	// هم‌پوشانی مستقل از ترتیب ثبت گزارش می‌شود.
+	other, err := redisorm.New(redis.NewClient(&redis.Options{Addr: "localhost:6379"}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := other.Register(&Inventory{}); err != nil {
+		t.Fatalf("Expected Inventory to register alone, got %v", err)
+	}
+	if err := other.Register(&Product{}); err == nil || !strings.Contains(err.Error(), `overlaps "inventory"`) {
+		t.Errorf("Expected Product to overlap Inventory, got %v", err)
+	}
+}